@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package audit
+
+import (
+	"github.com/argoeu/argo-web-api/utils/authentication"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"github.com/argoeu/argo-web-api/utils/mongo"
+	"net/http"
+	"strconv"
+)
+
+// List returns the audit records matching the actor, resource, from and to
+// parameters, newest first
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	if _, code = authentication.Authorize(r, cfg, authentication.AuditRead); code == http.StatusOK {
+
+		urlValues := r.URL.Query()
+
+		input := AuditInput{
+			urlValues.Get("actor"),
+			urlValues.Get("resource"),
+			urlValues.Get("from"),
+			urlValues.Get("to"),
+			defaultLimit,
+		}
+
+		if limit := urlValues.Get("limit"); limit != "" {
+			input.limit, err = strconv.Atoi(limit)
+			if err != nil || input.limit <= 0 {
+				input.limit = defaultLimit
+			}
+		}
+
+		filter, err := prepareFilter(input)
+
+		if err != nil {
+			output = messageView("Malformed time range, use the form " + zuluForm)
+
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		results := []AuditOutput{}
+		err = repo.C("audit").Find(filter).Sort("-timestamp").Limit(input.limit).All(&results)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		output = createView(results) //Respond renders the results into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the credentials are wrong or lack the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
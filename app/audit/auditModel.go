@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package audit
+
+import (
+	"encoding/xml"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"time"
+)
+
+// Records returned when the request sets no limit
+const defaultLimit = 1000
+
+type Record struct {
+	XMLName   xml.Name `xml:"Record" json:"-"`
+	Timestamp string   `xml:"timestamp,attr" json:"timestamp"`
+	Actor     string   `xml:"actor,attr" json:"actor"`
+	Method    string   `xml:"method,attr" json:"method"`
+	Verb      string   `xml:"verb,attr" json:"verb"`
+	Resource  string   `xml:"resource,attr" json:"resource"`
+	Route     string   `xml:"route,attr" json:"route"`
+	Code      int      `xml:"code,attr" json:"code"`
+	Body      string   `xml:"Body,omitempty" json:"body,omitempty"`
+	Before    string   `xml:"Before,omitempty" json:"before,omitempty"`
+	After     string   `xml:"After,omitempty" json:"after,omitempty"`
+}
+
+type root struct {
+	XMLName xml.Name  `xml:"root" json:"-"`
+	Record  []*Record `json:"records"`
+}
+
+type Message struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
+}
+
+type AuditInput struct {
+	actor    string
+	resource string // path prefix of the resources
+	from     string
+	to       string
+	limit    int
+}
+
+type AuditOutput struct {
+	Actor     string    `bson:"actor"`
+	Method    string    `bson:"method"`
+	Verb      string    `bson:"verb"`
+	Resource  string    `bson:"resource"`
+	Route     string    `bson:"route"`
+	Body      string    `bson:"body"`
+	Code      int       `bson:"code"`
+	Timestamp time.Time `bson:"timestamp"`
+	Before    string    `bson:"before"`
+	After     string    `bson:"after"`
+}
+
+const zuluForm = "2006-01-02T15:04:05Z"
+
+// prepareFilter builds the query of the records matching the input, failing
+// when the time range cannot be parsed
+func prepareFilter(input AuditInput) (bson.M, error) {
+
+	filter := bson.M{}
+
+	if input.actor != "" {
+		filter["actor"] = input.actor
+	}
+
+	if input.resource != "" {
+		filter["resource"] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(input.resource)}
+	}
+
+	timestamp := bson.M{}
+
+	if input.from != "" {
+		from, err := time.Parse(zuluForm, input.from)
+		if err != nil {
+			return filter, err
+		}
+		timestamp["$gte"] = from
+	}
+
+	if input.to != "" {
+		to, err := time.Parse(zuluForm, input.to)
+		if err != nil {
+			return filter, err
+		}
+		timestamp["$lt"] = to
+	}
+
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+
+	return filter, nil
+}
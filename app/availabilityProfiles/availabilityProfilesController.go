@@ -27,36 +27,72 @@
 package availabilityProfiles
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/argoeu/argo-web-api/utils/audit"
 	"github.com/argoeu/argo-web-api/utils/authentication"
+	"github.com/argoeu/argo-web-api/utils/caches"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
+	"github.com/argoeu/argo-web-api/utils/patch"
+	"github.com/argoeu/argo-web-api/utils/render"
+	"gopkg.in/yaml.v3"
 	"io/ioutil"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
+	contentType := render.FromRequest(r)
 
 	//STANDARD DECLARATIONS END
 
 	//Read the search values
 	urlValues := r.URL.Query()
 
-	//Searchig is based on name and namespace
-	input := AvailabilityProfileSearch{
+	//Every filter applies on its own, profiles are listed unfiltered when none is given
+	input := AvailabilityProfileFilter{
 		urlValues["name"],
 		urlValues["namespace"],
+		urlValues.Get("name_prefix"),
+		urlValues["service_flavor"],
+		urlValues["poem"],
+	}
+
+	sort, err := sortFields(urlValues.Get("sort"))
+
+	if err != nil {
+		output = messageView(err.Error())
+
+		code = http.StatusBadRequest
+		return code, h, output, err
+	}
+
+	//A limit of 0 lists every profile after the offset
+	offset := 0
+	limit, err := positiveParam(urlValues.Get("limit"))
+
+	if err == nil {
+		offset, err = positiveParam(urlValues.Get("offset"))
+	}
+
+	if err != nil {
+		output = messageView("The limit and offset must be positive numbers")
+
+		code = http.StatusBadRequest
+		return code, h, output, err
 	}
 
 	results := []AvailabilityProfileOutput{}
@@ -67,49 +103,197 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		return code, h, output, err
 	}
 
-	query := readOne(input)
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
+	query := repo.C("aps").Find(listFilter(input))
+
+	total, err := query.Count()
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	err = query.Sort(sort...).Skip(offset).Limit(limit).All(&results)
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	//The total tells clients paging through the profiles when to stop
+	h.Set("X-Total-Count", strconv.Itoa(total))
+
+	output = createView(results, contentType) //Respond renders the results into the negotiated format
+
+	return code, h, output, err
+}
+
+// ListOne returns the profile with the id given in the path, or one of its
+// older revisions given by the revision parameter
+func ListOne(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+	contentType := render.FromRequest(r)
+
+	//STANDARD DECLARATIONS END
+
+	//Extracting record id from url
+	id := strings.Split(r.URL.Path, "/")[4]
+
+	if !bson.IsObjectIdHex(id) {
+		output = messageView("Malformed profile id")
+
+		code = http.StatusBadRequest
+		return code, h, output, err
+	}
+
+	session, err := mongo.OpenSession(cfg)
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
+	results := []AvailabilityProfileOutput{}
+	err = repo.Find("aps", bson.M{"_id": bson.ObjectIdHex(id)}, "_id", &results)
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	//Older revisions are read from the history of the profile
+	if value := r.URL.Query().Get("revision"); value != "" {
+		revision, err := strconv.Atoi(value)
 
-	if len(input.Name) == 0 {
-		query = nil //If no name and namespace is provided then we have to retrieve all profiles thus we send nil into db query
+		if err != nil || revision <= 0 {
+			output = messageView("Malformed revision")
+
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
+
+		revisions := []RevisionOutput{}
+		err = repo.Find("aps_history", bson.M{"profile": bson.ObjectIdHex(id), "revision": revision}, "revision", &revisions)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		results = []AvailabilityProfileOutput{}
+		for _, row := range revisions {
+			results = append(results, profileOf(row))
+		}
+	}
+
+	if len(results) == 0 {
+		output = messageView("No profile matching the requested id")
+
+		code = http.StatusNotFound
+		return code, h, output, err
+	}
+
+	//The current revision is tagged for conditional updates
+	if r.URL.Query().Get("revision") == "" {
+		h.Set("ETag", revisionTag(results[0]))
+	}
+
+	output = createView(results, contentType) //Respond renders the results into the negotiated format
+
+	return code, h, output, err
+}
+
+// History lists the revisions of the profile with the id given in the path
+func History(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	//Extracting record id from url
+	id := strings.Split(r.URL.Path, "/")[4]
+
+	if !bson.IsObjectIdHex(id) {
+		output = messageView("Malformed profile id")
+
+		code = http.StatusBadRequest
+		return code, h, output, err
 	}
 
-	err = mongo.Find(session, cfg.MongoDB.Db, "aps", query, "_id", &results)
+	session, err := mongo.OpenSession(cfg)
 
 	if err != nil {
 		code = http.StatusInternalServerError
 		return code, h, output, err
 	}
 
-	mongo.CloseSession(session)
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
+	results := []RevisionOutput{}
+	err = repo.Find("aps_history", bson.M{"profile": bson.ObjectIdHex(id)}, "revision", &results)
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
 
-	output, err = createView(results) //Render the results into XML format
+	//Profiles stored before revisions were kept have no history yet
+	_, found, err := loadProfile(repo, id)
 
 	if err != nil {
 		code = http.StatusInternalServerError
 		return code, h, output, err
 	}
 
-	h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+	if len(results) == 0 && !found {
+		output = messageView("No profile matching the requested id")
+
+		code = http.StatusNotFound
+		return code, h, output, err
+	}
+
+	output = historyView(id, results) //Respond renders the results into the negotiated format
+
 	return code, h, output, err
 }
 
-func Create(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func Create(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
 
 	//STANDARD DECLARATIONS END
 
 	message := ""
 
 	//Authentication procedure
-	if authentication.Authenticate(r.Header, cfg) {
+	identity, code := authentication.Authorize(r, cfg, authentication.ProfilesWrite)
+
+	if code == http.StatusOK {
 
 		session, err := mongo.OpenSession(cfg)
 
@@ -118,44 +302,44 @@ func Create(r *http.Request, cfg config.Config) (int, http.Header, []byte, error
 			return code, h, output, err
 		}
 
-		name := []string{}
-		namespace := []string{}
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
 
 		//Reading the json input
 		reqBody, err := ioutil.ReadAll(r.Body)
 
 		input := AvailabilityProfileInput{}
-		results := []AvailabilityProfileOutput{}
 		//Unmarshalling the json input into byte form
 		err = json.Unmarshal(reqBody, &input)
 
 		if err != nil {
 			if err != nil {
 				message = "Malformated json input data" // User provided malformed json input data
-				output, err := messageXML(message)
-
-				if err != nil {
-					code = http.StatusInternalServerError
-					return code, h, output, err
-				}
+				output = messageView(message)
 
 				code = http.StatusBadRequest
-				h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
 				return code, h, output, err
 			}
 		}
 
-		//Making sure that no profile with the requested name and namespace combination already exists in the DB
-		name = append(name, input.Name)
-		namespace = append(namespace, input.Namespace)
+		//Making sure that the profile computes something
+		problems, err := checkProfile(repo, input)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		if len(problems) > 0 {
+			output = problemView(problems)
 
-		search := AvailabilityProfileSearch{
-			name,
-			namespace,
+			code = http.StatusUnprocessableEntity
+			return code, h, output, err
 		}
 
-		query := readOne(search)
-		err = mongo.Find(session, cfg.MongoDB.Db, "aps", query, "name", &results)
+		//Making sure that no profile with the requested name and namespace combination already exists in the DB
+		results, err := byName(repo, input)
 
 		if err != nil {
 			code = http.StatusInternalServerError
@@ -164,73 +348,78 @@ func Create(r *http.Request, cfg config.Config) (int, http.Header, []byte, error
 
 		if len(results) <= 0 {
 			//If name-namespace combination is unique we insert the new record into mongo
-			query := createOne(input)
-			err = mongo.Insert(session, cfg.MongoDB.Db, "aps", query)
+			id := bson.NewObjectId()
+			query := createOne(id, input)
+			err = repo.Insert("aps", query)
 
 			if err != nil {
 				code = http.StatusInternalServerError
 				return code, h, output, err
 			}
 
-			mongo.CloseSession(session)
-
-			//Providing with the appropriate user response
-			message = "Availability Profile record successfully created"
-			output, err := messageXML(message) //Render the response into XML
+			//The first revision of the profile starts its history
+			query = revisionOne(id, 1, "create", identity.Name, input, diff(AvailabilityProfileInput{}, input))
+			err = repo.Insert("aps_history", query)
 
 			if err != nil {
 				code = http.StatusInternalServerError
 				return code, h, output, err
 			}
 
-			h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+			//Cached availability reports may no longer be valid
+			caches.Purge(cfg, caches.Availability...)
+
+			//Providing with the appropriate user response
+			message = "Availability Profile record successfully created"
+			output = messageView(message) //Respond renders the response into the negotiated format
+
 			return code, h, output, err
 
 		} else {
 			message = "An availability profile with that name already exists"
-			output, err := messageXML(message) //Render the response into XML
-
-			if err != nil {
-				code = http.StatusInternalServerError
-				return code, h, output, err
-			}
+			output = messageView(message) //Respond renders the response into the negotiated format
 
 			code = http.StatusBadRequest
-			h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
 			return code, h, output, err
 		}
 
 	} else {
-		output = []byte(http.StatusText(http.StatusUnauthorized))
-		code = http.StatusUnauthorized //If wrong api key is passed we return UNAUTHORIZED http status
-		h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
 		return code, h, output, err
 	}
 
 }
 
-func Update(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func Update(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
 
 	//STANDARD DECLARATIONS END
 
 	message := ""
 
 	//Authentication procedure
-	if authentication.Authenticate(r.Header, cfg) {
+	identity, code := authentication.Authorize(r, cfg, authentication.ProfilesWrite)
+
+	if code == http.StatusOK {
 
 		//Extracting record id from url
 		urlValues := r.URL.Path
 		id := strings.Split(urlValues, "/")[4]
 
+		if !bson.IsObjectIdHex(id) {
+			message = "Malformed profile id"
+			output = messageView(message)
+
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
+
 		//Reading the json input
 		reqBody, err := ioutil.ReadAll(r.Body)
 
@@ -245,15 +434,9 @@ func Update(r *http.Request, cfg config.Config) (int, http.Header, []byte, error
 
 		if err != nil {
 			message = "Malformated json input data" // User provided malformed json input data
-			output, err := messageXML(message)
-
-			if err != nil {
-				code = http.StatusInternalServerError
-				return code, h, output, err
-			}
+			output = messageView(message)
 
 			code = http.StatusBadRequest
-			h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
 			return code, h, output, err
 		}
 
@@ -264,110 +447,919 @@ func Update(r *http.Request, cfg config.Config) (int, http.Header, []byte, error
 			return code, h, output, err
 		}
 
-		//We update the record bassed on its unique id
-		err = mongo.IdUpdate(session, cfg.MongoDB.Db, "aps", id, input)
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
 
-		mongo.CloseSession(session)
+		before, found, err := loadProfile(repo, id)
 
 		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		if !found {
 			message = "No profile matching the requested id" //If not found we inform the user
-			output, err := messageXML(message)
+			output = messageView(message)
 
-			if err != nil {
-				code = http.StatusInternalServerError
-				return code, h, output, err
-			}
+			code = http.StatusNotFound
+			return code, h, output, err
+		}
 
-			code = http.StatusBadRequest
-			h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+		//Making sure that the profile computes something
+		problems, err := checkProfile(repo, input)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		if len(problems) > 0 {
+			output = problemView(problems)
+
+			code = http.StatusUnprocessableEntity
+			return code, h, output, err
+		}
+
+		//The audit log keeps the profile as it was before and after the update
+		entry := audit.FromRequest(r)
+
+		if entry != nil {
+			entry.Before = profileDocument(repo, id)
+		}
+
+		//We store the update as a new revision of the profile
+		_, err = saveRevision(repo, before, input, "update", identity.Name)
+
+		if err == nil && entry != nil {
+			entry.After = profileDocument(repo, id)
+		}
+
+		if err == errNameTaken {
+			message = err.Error()
+			output = messageView(message)
+
+			code = http.StatusConflict
+			return code, h, output, err
+
+		} else if err == mgo.ErrNotFound {
+			message = "The profile was changed by another request, please retry"
+			output = messageView(message)
+
+			code = http.StatusConflict
+			return code, h, output, err
+
+		} else if err != nil {
+			code = http.StatusInternalServerError
 			return code, h, output, err
 
 		} else {
+			//Cached availability reports may no longer be valid
+			caches.Purge(cfg, caches.Availability...)
+
 			// Everything went fine and profile was deleted
 			message = "Availability Profile was successfully updated"
-			output, err := messageXML(message) //Render the response into XML
-
-			if err != nil {
-				code = http.StatusInternalServerError
-				return code, h, output, err
-			}
+			output = messageView(message) //Respond renders the response into the negotiated format
 
-			h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
 			return code, h, output, err
 		}
 	} else {
-		code = http.StatusUnauthorized
-		h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
-		output = []byte(http.StatusText(http.StatusUnauthorized)) //If wrong api key is passed we return UNAUTHORIZED http status
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+
+}
+
+// Export writes the profiles selected by the filters of List, or every
+// profile, into a bundle that Import reads back. Bundles are JSON documents
+// unless YAML is asked for with format=yaml or the Accept header.
+func Export(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	urlValues := r.URL.Query()
+
+	//The profiles are selected with the same filters as in List
+	input := AvailabilityProfileFilter{
+		urlValues["name"],
+		urlValues["namespace"],
+		urlValues.Get("name_prefix"),
+		urlValues["service_flavor"],
+		urlValues["poem"],
+	}
+
+	contentType := render.FromRequest(r)
+
+	results := []AvailabilityProfileOutput{}
+	session, err := mongo.OpenSession(cfg)
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
+	err = repo.C("aps").Find(listFilter(input)).Sort("namespace", "name").All(&results)
+
+	if err != nil {
+		code = http.StatusInternalServerError
 		return code, h, output, err
 	}
 
+	output = bundleView(results)
+
+	if contentType == render.JSON {
+		h.Set("Content-Disposition", `attachment; filename="profiles.json"`)
+	} else {
+		h.Set("Content-Disposition", `attachment; filename="profiles.yaml"`)
+	}
+
+	return code, h, output, err
 }
 
-func Delete(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+// Import creates the profiles of a bundle that are missing and updates the
+// ones that differ, matching them by name and namespace. The bundle is
+// checked as a whole before any profile is written, and with dry_run=true
+// nothing is written at all. The answer lists what was, or would be, done
+// to every profile.
+func Import(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
 
 	//STANDARD DECLARATIONS END
+
 	message := ""
 
 	//Authentication procedure
-	if authentication.Authenticate(r.Header, cfg) {
+	identity, code := authentication.Authorize(r, cfg, authentication.ProfilesWrite)
 
-		//Extracting record id from url
-		urlValues := r.URL.Path
-		id := strings.Split(urlValues, "/")[4]
-		session, err := mongo.OpenSession(cfg)
+	if code == http.StatusOK {
+
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+
+		//Reading the bundle in JSON or YAML
+		reqBody, err := ioutil.ReadAll(r.Body)
 
 		if err != nil {
 			code = http.StatusInternalServerError
 			return code, h, output, err
 		}
 
-		//We remove the record bassed on its unique id
-		err = mongo.IdRemove(session, cfg.MongoDB.Db, "aps", id)
-		mongo.CloseSession(session)
+		bundle := Bundle{}
+
+		if isYAML(r.Header.Get("Content-Type")) {
+			err = yaml.Unmarshal(reqBody, &bundle)
+		} else {
+			err = json.Unmarshal(reqBody, &bundle)
+		}
 
 		if err != nil {
+			message = "Malformed bundle: " + err.Error() // User provided a bundle that cannot be read
+			output = messageView(message)
 
-			message = "No profile matching the requested id" //If not found we inform the user
-			output, err := messageXML(message)
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
 
-			if err != nil {
-				code = http.StatusInternalServerError
-				return code, h, output, err
-			}
+		if bundle.Version > bundleVersion {
+			message = "Unsupported bundle version " + strconv.Itoa(bundle.Version)
+			output = messageView(message)
 
 			code = http.StatusBadRequest
-			h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
 			return code, h, output, err
-		} else {
+		}
 
-			// Everything went fine and profile was deleted
-			message = "Availability Profile was successfully deleted"
-			output, err := messageXML(message) //Render the response into XML
+		session, err := mongo.OpenSession(cfg)
 
-			if err != nil {
-				code = http.StatusInternalServerError
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		//Every profile of the bundle is checked before any is written
+		problems := []*Problem{}
+		listed := map[string]bool{}
+
+		for i, input := range bundle.Profiles {
+
+			found, err := checkProfile(repo, input)
+
+			if err != nil {
+				code = http.StatusInternalServerError
+				return code, h, output, err
+			}
+
+			key := input.Namespace + "/" + input.Name
+
+			if listed[key] {
+				found = append(found, &Problem{Field: "name", Value: input.Name, Message: "The bundle lists the profile more than once"})
+			}
+
+			listed[key] = true
+
+			for _, problem := range found {
+				problem.Field = fmt.Sprintf("profiles[%d].%s", i, problem.Field)
+				problems = append(problems, problem)
+			}
+		}
+
+		if len(problems) > 0 {
+			output = problemView(problems)
+
+			code = http.StatusUnprocessableEntity
+			return code, h, output, err
+		}
+
+		//Every profile is matched with the stored ones before any is written
+		imported := []*Imported{}
+		steps := []importStep{}
+
+		for _, input := range bundle.Profiles {
+
+			step := importStep{result: &Imported{Name: input.Name, Namespace: input.Namespace}, input: input}
+			imported = append(imported, step.result)
+
+			//The same name and namespace combination that Create keeps unique
+			//tells the profile the definition is meant for
+			results, err := byName(repo, input)
+
+			if err != nil {
+				code = http.StatusInternalServerError
+				return code, h, output, err
+			}
+
+			step.changes = diff(AvailabilityProfileInput{}, input)
+			step.result.Action = "create"
+
+			if len(results) > 0 {
+				step.before = results[0]
+				step.result.ID = results[0].ID.Hex()
+				step.changes = diff(inputOf(results[0]), input)
+				step.result.Action = "update"
+				if len(step.changes) == 0 {
+					step.result.Action = "unchanged"
+				}
+			}
+
+			for _, change := range step.changes {
+				step.result.Change = append(step.result.Change, &Change{Field: change.Field, From: change.From, To: change.To})
+			}
+
+			steps = append(steps, step)
+		}
+
+		if !dryRun {
+			written, err := importProfiles(cfg, repo, steps, identity.Name)
+
+			if err == mgo.ErrNotFound || err == errNameTaken {
+				message = fmt.Sprintf("The profile %s/%s was changed by another request after %d profiles of the bundle were imported, please retry",
+					steps[written].input.Namespace, steps[written].input.Name, written)
+				if err == errNameTaken {
+					message = fmt.Sprintf("The profile %s/%s takes the name of another profile after %d profiles of the bundle were imported",
+						steps[written].input.Namespace, steps[written].input.Name, written)
+				}
+				output = messageView(message)
+
+				code = http.StatusConflict
+				return code, h, output, err
+
+			} else if err != nil {
+				code = http.StatusInternalServerError
+				return code, h, output, err
+			}
+		}
+
+		output = importView(dryRun, imported) //Respond renders the response into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+// Patch changes some fields of a profile with a JSON Merge Patch or, when the
+// Content-Type is application/json-patch+json, a JSON Patch. The change is
+// refused when the If-Match header does not match the current revision.
+func Patch(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	message := ""
+
+	//Authentication procedure
+	identity, code := authentication.Authorize(r, cfg, authentication.ProfilesWrite)
+
+	if code == http.StatusOK {
+
+		//Extracting record id from url
+		id := strings.Split(r.URL.Path, "/")[4]
+
+		if !bson.IsObjectIdHex(id) {
+			message = "Malformed profile id"
+			output = messageView(message)
+
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
+
+		//Reading the json input
+		reqBody, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		before, found, err := loadProfile(repo, id)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		if !found {
+			message = "No profile matching the requested id" //If not found we inform the user
+			output = messageView(message)
+
+			code = http.StatusNotFound
+			return code, h, output, err
+		}
+
+		ifMatch := r.Header.Get("If-Match")
+
+		if ifMatch != "" && !matches(ifMatch, revisionTag(before)) {
+			message = "The profile was changed, its current revision is " + strconv.Itoa(before.Revision)
+			output = messageView(message)
+
+			h.Set("ETag", revisionTag(before))
+			code = http.StatusPreconditionFailed
+			return code, h, output, err
+		}
+
+		input, err := patchProfile(inputOf(before), reqBody, r.Header.Get("Content-Type"))
+
+		if err == patch.ErrTestFailed {
+			message = err.Error()
+			output = messageView(message)
+
+			code = http.StatusConflict
+			return code, h, output, err
+
+		} else if err != nil {
+			message = "Malformed patch: " + err.Error() // User provided a patch that does not apply
+			output = messageView(message)
+
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
+
+		//Making sure that the profile computes something
+		problems, err := checkProfile(repo, input)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		if len(problems) > 0 {
+			output = problemView(problems)
+
+			code = http.StatusUnprocessableEntity
+			return code, h, output, err
+		}
+
+		//The audit log keeps the profile as it was before and after the update
+		entry := audit.FromRequest(r)
+
+		if entry != nil {
+			entry.Before = profileDocument(repo, id)
+		}
+
+		revision, err := saveRevision(repo, before, input, "patch", identity.Name)
+
+		if err == nil && entry != nil {
+			entry.After = profileDocument(repo, id)
+		}
+
+		if err == errNameTaken {
+			message = err.Error()
+			output = messageView(message)
+
+			code = http.StatusConflict
+			return code, h, output, err
+
+		} else if err == mgo.ErrNotFound {
+			message = "The profile was changed by another request, please retry"
+			output = messageView(message)
+
+			code = http.StatusConflict
+			if ifMatch != "" {
+				code = http.StatusPreconditionFailed
+			}
+			return code, h, output, err
+
+		} else if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		//Cached availability reports may no longer be valid
+		caches.Purge(cfg, caches.Availability...)
+
+		before.Revision = revision
+		h.Set("ETag", revisionTag(before))
+
+		message = "Availability Profile was successfully updated"
+		output = messageView(message) //Respond renders the response into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+// Rollback restores the definition of an older revision of a profile, given
+// by the revision parameter, as a new revision
+func Rollback(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	message := ""
+
+	//Authentication procedure
+	identity, code := authentication.Authorize(r, cfg, authentication.ProfilesWrite)
+
+	if code == http.StatusOK {
+
+		//Extracting record id from url
+		id := strings.Split(r.URL.Path, "/")[4]
+		revision, err := strconv.Atoi(r.URL.Query().Get("revision"))
+
+		if !bson.IsObjectIdHex(id) || err != nil || revision <= 0 {
+			message = "Malformed profile id or revision"
+			output = messageView(message)
+
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		before, found, err := loadProfile(repo, id)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		revisions := []RevisionOutput{}
+
+		if found {
+			err = repo.Find("aps_history", bson.M{"profile": before.ID, "revision": revision}, "revision", &revisions)
+
+			if err != nil {
+				code = http.StatusInternalServerError
 				return code, h, output, err
 			}
+		}
+
+		if len(revisions) == 0 {
+			message = "No revision " + strconv.Itoa(revision) + " of a profile matching the requested id"
+			output = messageView(message)
+
+			code = http.StatusNotFound
+			return code, h, output, err
+		}
+
+		//The audit log keeps the profile as it was before and after the rollback
+		entry := audit.FromRequest(r)
+
+		if entry != nil {
+			entry.Before = profileDocument(repo, id)
+		}
+
+		_, err = saveRevision(repo, before, inputOf(profileOf(revisions[0])), "rollback", identity.Name)
+
+		if err == nil && entry != nil {
+			entry.After = profileDocument(repo, id)
+		}
+
+		if err == errNameTaken {
+			message = err.Error()
+			output = messageView(message)
+
+			code = http.StatusConflict
+			return code, h, output, err
+
+		} else if err == mgo.ErrNotFound {
+			message = "The profile was changed by another request, please retry"
+			output = messageView(message)
+
+			code = http.StatusConflict
+			return code, h, output, err
+
+		} else if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		//Cached availability reports may no longer be valid
+		caches.Purge(cfg, caches.Availability...)
+
+		message = "Availability Profile was rolled back to revision " + strconv.Itoa(revision)
+		output = messageView(message) //Respond renders the response into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+func Delete(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+	message := ""
+
+	//Authentication procedure
+	if _, code = authentication.Authorize(r, cfg, authentication.ProfilesWrite); code == http.StatusOK {
+
+		//Extracting record id from url
+		urlValues := r.URL.Path
+		id := strings.Split(urlValues, "/")[4]
+
+		if !bson.IsObjectIdHex(id) {
+			message = "Malformed profile id"
+			output = messageView(message)
+
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		//The audit log keeps the profile that is removed
+		if entry := audit.FromRequest(r); entry != nil {
+			entry.Before = profileDocument(repo, id)
+		}
+
+		//We remove the record bassed on its unique id
+		err = repo.IdRemove("aps", id)
+
+		if err == mgo.ErrNotFound {
+
+			message = "No profile matching the requested id" //If not found we inform the user
+			output = messageView(message)
+
+			code = http.StatusNotFound
+			return code, h, output, err
+		} else if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		} else {
+
+			//Cached availability reports may no longer be valid
+			caches.Purge(cfg, caches.Availability...)
+
+			// Everything went fine and profile was deleted
+			message = "Availability Profile was successfully deleted"
+			output = messageView(message) //Respond renders the response into the negotiated format
 
-			h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
 			return code, h, output, err
 		}
 	} else {
 
-		code = http.StatusUnauthorized
-		output = []byte(http.StatusText(http.StatusUnauthorized)) //If wrong api key is passed we return UNAUTHORIZED http status
-		h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
 		return code, h, output, err
 	}
 
 }
+
+// profileDocument returns the stored document of a profile, or nil when there
+// is none
+func profileDocument(repo *mongo.Repository, id string) interface{} {
+
+	if !bson.IsObjectIdHex(id) {
+		return nil
+	}
+
+	results := []bson.M{}
+	err := repo.Find("aps", bson.M{"_id": bson.ObjectIdHex(id)}, "_id", &results)
+
+	if err != nil || len(results) == 0 {
+		return nil
+	}
+
+	return results[0]
+}
+
+// checkProfile validates a profile against the POEM profiles it lists
+func checkProfile(repo *mongo.Repository, input AvailabilityProfileInput) ([]*Problem, error) {
+
+	poems := []string{}
+	flavors := []string{}
+
+	if len(input.Poems) == 0 {
+		return validate(input, poems, flavors), nil
+	}
+
+	query := bson.M{"p": bson.M{"$in": input.Poems}}
+
+	err := repo.C("poem_list").Find(query).Distinct("p", &poems)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.C("poem_details").Find(query).Distinct("s", &flavors)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return validate(input, poems, flavors), nil
+}
+
+// byName finds the stored profiles with the name and namespace of a
+// definition. The combination is unique, so at most one is found.
+func byName(repo *mongo.Repository, input AvailabilityProfileInput) ([]AvailabilityProfileOutput, error) {
+
+	results := []AvailabilityProfileOutput{}
+
+	search := AvailabilityProfileSearch{
+		[]string{input.Name},
+		[]string{input.Namespace},
+	}
+
+	err := repo.Find("aps", readOne(search), "name", &results)
+	return results, err
+}
+
+// nameTaken tells whether a profile other than the one with the given id
+// already has the name and namespace of a definition
+func nameTaken(repo *mongo.Repository, id bson.ObjectId, input AvailabilityProfileInput) (bool, error) {
+
+	results, err := byName(repo, input)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, result := range results {
+		if result.ID != id {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// positiveParam reads a query parameter that must be a positive number or
+// left out, in which case it is 0
+func positiveParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err == nil && number < 0 {
+		err = strconv.ErrRange
+	}
+	return number, err
+}
+
+// isYAML tells whether a Content-Type or Accept value names YAML
+func isYAML(mediaType string) bool {
+	mediaType, _, _ = mime.ParseMediaType(mediaType)
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+// loadProfile reads the stored profile with the given id
+func loadProfile(repo *mongo.Repository, id string) (AvailabilityProfileOutput, bool, error) {
+
+	results := []AvailabilityProfileOutput{}
+	err := repo.Find("aps", bson.M{"_id": bson.ObjectIdHex(id)}, "_id", &results)
+
+	if err != nil || len(results) == 0 {
+		return AvailabilityProfileOutput{}, false, err
+	}
+
+	return results[0], true, nil
+}
+
+// saveRevision replaces the definition of a profile with a new revision and
+// records it in the history along with what changed. Profiles stored before
+// revisions were kept get their current definition recorded as revision 1
+// first. The update only applies to the revision that was read, so
+// mgo.ErrNotFound is returned when another request changed the profile
+// in the meantime. A definition that takes the name and namespace of another
+// profile is refused with errNameTaken.
+func saveRevision(repo *mongo.Repository, before AvailabilityProfileOutput, after AvailabilityProfileInput, action string, author string) (int, error) {
+
+	taken, err := nameTaken(repo, before.ID, after)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if taken {
+		return 0, errNameTaken
+	}
+
+	filter := bson.M{"_id": before.ID, "revision": before.Revision}
+	current := before.Revision
+
+	if current == 0 {
+		filter["revision"] = nil
+		current = 1
+	}
+
+	revision := current + 1
+	err = repo.C("aps").Update(filter, updateOne(after, revision))
+
+	if err != nil {
+		return 0, err
+	}
+
+	if before.Revision == 0 {
+		err = repo.Insert("aps_history", revisionOne(before.ID, current, "baseline", "", inputOf(before), nil))
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = repo.Insert("aps_history", revisionOne(before.ID, revision, action, author, after, diff(inputOf(before), after)))
+
+	return revision, err
+}
+
+// importProfiles writes the planned steps of an import in order and returns
+// how many profiles it wrote before it stopped. Cached availability reports
+// are purged once a write was attempted, even when the import stops half way.
+func importProfiles(cfg config.Config, repo *mongo.Repository, steps []importStep, author string) (int, error) {
+
+	written := 0
+	attempted := false
+
+	defer func() {
+		if attempted {
+			caches.Purge(cfg, caches.Availability...)
+		}
+	}()
+
+	for _, step := range steps {
+
+		var err error
+
+		switch step.result.Action {
+		case "create":
+			attempted = true
+			id := bson.NewObjectId()
+			step.result.ID = id.Hex()
+			err = repo.Insert("aps", createOne(id, step.input))
+
+			if err == nil {
+				err = repo.Insert("aps_history", revisionOne(id, 1, "import", author, step.input, step.changes))
+			}
+		case "update":
+			attempted = true
+			_, err = saveRevision(repo, step.before, step.input, "import", author)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return written, err
+		}
+
+		written++
+	}
+
+	return written, nil
+}
+
+// patchProfile applies a patch of the given media type to the definition of a
+// profile. Only the fields of the definition can be patched, the groups as
+// well as the expression.
+func patchProfile(input AvailabilityProfileInput, body []byte, mediaType string) (AvailabilityProfileInput, error) {
+
+	if input.Groups == nil {
+		input.Groups = [][]string{}
+	}
+
+	if input.Poems == nil {
+		input.Poems = []string{}
+	}
+
+	doc, err := json.Marshal(input)
+
+	if err != nil {
+		return input, err
+	}
+
+	mediaType, _, _ = mime.ParseMediaType(mediaType)
+
+	if mediaType == "application/json-patch+json" {
+		doc, err = patch.Apply(doc, body)
+	} else {
+		doc, err = patch.Merge(doc, body)
+	}
+
+	if err != nil {
+		return input, err
+	}
+
+	patched := AvailabilityProfileInput{}
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&patched)
+
+	//The form of the definition that was left alone is derived again from
+	//the one that was patched
+	switch {
+	case jsonString(patched.Groups) == jsonString(input.Groups) && patched.Expression != nil:
+		patched.Groups = nil
+	case jsonString(patched.Expression) == jsonString(input.Expression):
+		patched.Expression = nil
+	}
+
+	return patched, err
+}
@@ -27,50 +27,163 @@
 package availabilityProfiles
 
 import (
+	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"labix.org/v2/mgo/bson"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Group struct {
-	XMLName       xml.Name
-	ServiceFlavor string `xml:"service_flavor,attr"`
+	XMLName       xml.Name `json:"-"`
+	ServiceFlavor string   `xml:"service_flavor,attr" json:"service_flavor"`
 }
 
 type Or struct {
-	XMLName xml.Name `xml:"OR"`
-	Group   []*Group
+	XMLName xml.Name `xml:"OR" json:"-"`
+	Group   []*Group `json:"groups"`
 }
 
 type And struct {
-	XMLName xml.Name `xml:"AND"`
-	Or      []*Or
+	XMLName xml.Name `xml:"AND" json:"-"`
+	Or      []*Or    `json:"or"`
 }
 
 type Profile struct {
-	XMLName   xml.Name `xml:"profile"`
-	ID        string   `xml:"id,attr"`
-	Name      string   `xml:"name,attr"`
-	Namespace string   `xml:"namespace,attr"`
-	Poem      string   `xml:"poems,attr"`
-	And       *And
+	XMLName   xml.Name `xml:"profile" json:"-"`
+	ID        string   `xml:"id,attr" json:"id"`
+	Name      string   `xml:"name,attr" json:"name"`
+	Namespace string   `xml:"namespace,attr" json:"namespace"`
+	Poem      string   `xml:"poems,attr" json:"poems"`
+	Revision  int      `xml:"revision,attr,omitempty" json:"revision,omitempty"`
+	And       *And     `json:"and,omitempty"`
+	Node      *Node    `xml:"expression>node" json:"expression,omitempty"` // profiles that cannot be written as groups
+	Formula   string   `xml:"expression,attr,omitempty" json:"-"`          // the expression in CSV, whose columns cannot nest
+}
+
+// Node is an operator of an expression, rendered as an AND, OR or AT_LEAST
+// element, or a service flavor, rendered as a Group element
+type Node struct {
+	XMLName       xml.Name `json:"-"`
+	Op            string   `xml:"-" json:"op,omitempty"`
+	K             int      `xml:"k,attr,omitempty" json:"k,omitempty"`
+	ServiceFlavor string   `xml:"service_flavor,attr,omitempty" json:"service_flavor,omitempty"`
+	Node          []*Node  `json:"operands,omitempty"`
+}
+
+type Change struct {
+	XMLName xml.Name `xml:"Change" json:"-"`
+	Field   string   `xml:"field,attr" json:"field"`
+	From    string   `xml:"from,attr" json:"from"`
+	To      string   `xml:"to,attr" json:"to"`
+}
+
+type Revision struct {
+	XMLName   xml.Name  `xml:"Revision" json:"-"`
+	Revision  int       `xml:"revision,attr" json:"revision"`
+	Action    string    `xml:"action,attr" json:"action"`
+	Author    string    `xml:"author,attr" json:"author"`
+	Timestamp string    `xml:"timestamp,attr" json:"timestamp"`
+	Change    []*Change `json:"changes"`
+}
+
+type HistoryRoot struct {
+	XMLName  xml.Name    `xml:"root" json:"-"`
+	ID       string      `xml:"id,attr" json:"id"`
+	Revision []*Revision `json:"revisions"`
 }
 
 type ReadRoot struct {
-	XMLName xml.Name `xml:"root"`
-	Profile []*Profile
+	XMLName xml.Name   `xml:"root" json:"-"`
+	Profile []*Profile `json:"profiles"`
 }
 
 type Message struct {
-	XMLName xml.Name `xml:"root"`
-	Message string
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
+}
+
+type Problem struct {
+	XMLName xml.Name `xml:"Problem" json:"-"`
+	Field   string   `xml:"field,attr" json:"field"`
+	Value   string   `xml:"value,attr,omitempty" json:"value,omitempty"`
+	Message string   `xml:",chardata" json:"message"`
+}
+
+type ProblemRoot struct {
+	XMLName xml.Name   `xml:"root" json:"-"`
+	Message string     `json:"message"`
+	Problem []*Problem `json:"problems"`
 }
 
 //Struct for inserting data into DB
 type AvailabilityProfileInput struct {
-	Name      string     `json:"name"`
-	Namespace string     `json:"namespace"`
-	Groups    [][]string `json:"groups"`
-	Poems     []string   `json:"poems"`
+	Name       string      `json:"name" yaml:"name"`
+	Namespace  string      `json:"namespace" yaml:"namespace"`
+	Groups     [][]string  `json:"groups" yaml:"groups,omitempty"`
+	Expression *Expression `json:"expression,omitempty" yaml:"expression,omitempty"`
+	Poems      []string    `json:"poems" yaml:"poems"`
+}
+
+// Operators of an expression
+const (
+	AndOp     = "AND"      // every operand is up
+	OrOp      = "OR"       // at least one operand is up
+	AtLeastOp = "AT_LEAST" // at least K operands are up
+)
+
+// Expression is the boolean expression of service flavors a profile
+// computes. Operators carry Op and their Operands, leaves a ServiceFlavor.
+// The legacy groups of a profile are the expression AND of ORs.
+type Expression struct {
+	Op            string        `bson:"op,omitempty" json:"op,omitempty" yaml:"op,omitempty"`
+	K             int           `bson:"k,omitempty" json:"k,omitempty" yaml:"k,omitempty"`
+	ServiceFlavor string        `bson:"service_flavor,omitempty" json:"service_flavor,omitempty" yaml:"service_flavor,omitempty"`
+	Operands      []*Expression `bson:"operands,omitempty" json:"operands,omitempty" yaml:"operands,omitempty"`
+}
+
+// bundleVersion is the version of the bundles written by export. Import
+// refuses bundles of later versions.
+const bundleVersion = 1
+
+// errNameTaken is returned when a profile would take the name and namespace
+// of another one
+var errNameTaken = errors.New("An availability profile with that name already exists")
+
+// Bundle is a set of profile definitions exported from one installation
+// and imported into another, in JSON or YAML
+type Bundle struct {
+	Version  int                        `json:"version" yaml:"version"`
+	Exported string                     `json:"exported,omitempty" yaml:"exported,omitempty"`
+	Profiles []AvailabilityProfileInput `json:"profiles" yaml:"profiles"`
+}
+
+// importStep is a profile of an imported bundle along with the stored
+// profile it updates, if any, and the changes it makes
+type importStep struct {
+	result  *Imported
+	input   AvailabilityProfileInput
+	before  AvailabilityProfileOutput
+	changes []ChangeOutput
+}
+
+type Imported struct {
+	XMLName   xml.Name  `xml:"profile" json:"-"`
+	ID        string    `xml:"id,attr,omitempty" json:"id,omitempty"`
+	Name      string    `xml:"name,attr" json:"name"`
+	Namespace string    `xml:"namespace,attr" json:"namespace"`
+	Action    string    `xml:"action,attr" json:"action"` // create, update or unchanged
+	Change    []*Change `json:"changes"`
+}
+
+type ImportRoot struct {
+	XMLName  xml.Name    `xml:"root" json:"-"`
+	DryRun   bool        `xml:"dry_run,attr" json:"dry_run"`
+	Imported []*Imported `json:"profiles"`
 }
 
 //Struct for searching based on name and namespace combination
@@ -79,13 +192,53 @@ type AvailabilityProfileSearch struct {
 	Namespace []string
 }
 
+//Struct for listing profiles, each filter applies only when given
+type AvailabilityProfileFilter struct {
+	Name          []string
+	Namespace     []string
+	NamePrefix    string
+	ServiceFlavor []string // the profile uses any of them
+	Poem          []string // the profile uses any of them
+}
+
+// The fields profiles can be sorted by along with the stored field
+var sortable = map[string]string{
+	"id":        "_id",
+	"name":      "name",
+	"namespace": "namespace",
+}
+
 //Struct for record retrieval
 type AvailabilityProfileOutput struct {
-	ID        bson.ObjectId `bson:"_id"`
-	Name      string        `bson:"name"`
-	Namespace string        `bson:"namespace"`
-	Groups    [][]string    `bson:"groups"`
-	Poems     []string      `bson:"poems"`
+	ID         bson.ObjectId `bson:"_id"`
+	Name       string        `bson:"name"`
+	Namespace  string        `bson:"namespace"`
+	Groups     [][]string    `bson:"groups"`
+	Expression *Expression   `bson:"expression"` // unset for profiles stored before expressions were kept
+	Poems      []string      `bson:"poems"`
+	Flavors    []string      `bson:"flavors"`  // every service flavor of the profile, for searching
+	Revision   int           `bson:"revision"` // 0 for profiles stored before revisions were kept
+}
+
+//Struct for the revisions kept in aps_history
+type RevisionOutput struct {
+	Profile    bson.ObjectId  `bson:"profile"`
+	Revision   int            `bson:"revision"`
+	Action     string         `bson:"action"` // baseline, create, update, patch, rollback or import
+	Author     string         `bson:"author"`
+	Timestamp  time.Time      `bson:"timestamp"`
+	Name       string         `bson:"name"`
+	Namespace  string         `bson:"namespace"`
+	Groups     [][]string     `bson:"groups"`
+	Expression *Expression    `bson:"expression"`
+	Poems      []string       `bson:"poems"`
+	Changes    []ChangeOutput `bson:"changes"`
+}
+
+type ChangeOutput struct {
+	Field string `bson:"field"`
+	From  string `bson:"from"`
+	To    string `bson:"to"`
 }
 
 func prepareFilter(input AvailabilityProfileSearch) bson.M {
@@ -98,17 +251,433 @@ func prepareFilter(input AvailabilityProfileSearch) bson.M {
 	return filter
 }
 
-func createOne(input AvailabilityProfileInput) bson.M {
+func createOne(id bson.ObjectId, input AvailabilityProfileInput) bson.M {
+	query := updateOne(input, 1)
+	query["_id"] = id
+	return query
+}
+
+func updateOne(input AvailabilityProfileInput, revision int) bson.M {
+	input = normalize(input)
 	query := bson.M{
-		"name":      input.Name,
-		"namespace": input.Namespace,
-		"groups":    input.Groups,
-		"poems":     input.Poems,
+		"name":       input.Name,
+		"namespace":  input.Namespace,
+		"groups":     input.Groups,
+		"expression": input.Expression,
+		"poems":      input.Poems,
+		"flavors":    flavorsOf(input.Expression, []string{}),
+		"revision":   revision,
 	}
 	return query
 }
 
+func revisionOne(id bson.ObjectId, revision int, action string, author string, input AvailabilityProfileInput, changes []ChangeOutput) bson.M {
+	input = normalize(input)
+	query := bson.M{
+		"profile":    id,
+		"revision":   revision,
+		"action":     action,
+		"author":     author,
+		"timestamp":  time.Now().UTC(),
+		"name":       input.Name,
+		"namespace":  input.Namespace,
+		"groups":     input.Groups,
+		"expression": input.Expression,
+		"poems":      input.Poems,
+		"changes":    changes,
+	}
+	return query
+}
+
+// revisionTag is the entity tag of a revision of a profile, which clients
+// send back in If-Match to make sure they change the revision they read
+func revisionTag(profile AvailabilityProfileOutput) string {
+	return fmt.Sprintf(`"%s-%d"`, profile.ID.Hex(), profile.Revision)
+}
+
+// matches tells whether an If-Match header lists the tag
+func matches(ifMatch string, tag string) bool {
+	for _, t := range strings.Split(ifMatch, ",") {
+		if t = strings.TrimSpace(t); t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// profileOf returns a profile as it was defined by a revision
+func profileOf(revision RevisionOutput) AvailabilityProfileOutput {
+	return AvailabilityProfileOutput{revision.Profile, revision.Name, revision.Namespace, revision.Groups, revision.Expression, revision.Poems, nil, revision.Revision}
+}
+
+// inputOf returns the definition of a stored profile
+func inputOf(profile AvailabilityProfileOutput) AvailabilityProfileInput {
+	return normalize(AvailabilityProfileInput{profile.Name, profile.Namespace, profile.Groups, profile.Expression, profile.Poems})
+}
+
+// normalize completes a definition given either as groups or as an
+// expression with the other form. Groups are left unset when the expression
+// cannot be written as groups.
+func normalize(input AvailabilityProfileInput) AvailabilityProfileInput {
+	if input.Expression == nil && len(input.Groups) > 0 {
+		input.Expression = expressionOf(input.Groups)
+	} else if input.Expression != nil && input.Groups == nil {
+		input.Groups = groupsOf(input.Expression)
+	}
+	return input
+}
+
+// expressionOf returns the AND of ORs that groups stand for
+func expressionOf(groups [][]string) *Expression {
+	and := &Expression{Op: AndOp}
+	for _, group := range groups {
+		or := &Expression{Op: OrOp}
+		for _, flavor := range group {
+			or.Operands = append(or.Operands, &Expression{ServiceFlavor: flavor})
+		}
+		and.Operands = append(and.Operands, or)
+	}
+	return and
+}
+
+// formula writes an expression on one line, e.g.
+// (CREAM-CE OR ARC-CE) AND AT_LEAST(2, SRM, webdav, xrootd)
+func formula(expression *Expression) string {
+
+	if expression.Op == "" {
+		return expression.ServiceFlavor
+	}
+
+	operands := []string{}
+	for _, operand := range expression.Operands {
+		term := formula(operand)
+		if operand.Op == AndOp || operand.Op == OrOp {
+			term = "(" + term + ")"
+		}
+		operands = append(operands, term)
+	}
+
+	if expression.Op == AtLeastOp {
+		return fmt.Sprintf("%s(%d, %s)", AtLeastOp, expression.K, strings.Join(operands, ", "))
+	}
+
+	return strings.Join(operands, " "+expression.Op+" ")
+}
+
+// groupsOf writes an expression as groups, or returns nil when it is not an
+// AND of ORs of service flavors. Single service flavors and ORs standing
+// for the whole expression or for an operand of the AND count as groups.
+func groupsOf(expression *Expression) [][]string {
+
+	operands := []*Expression{expression}
+	if expression.Op == AndOp {
+		operands = expression.Operands
+	}
+
+	groups := [][]string{}
+
+	for _, operand := range operands {
+		group := []string{}
+		switch {
+		case operand == nil:
+			return nil
+		case operand.Op == "" && operand.ServiceFlavor != "":
+			group = append(group, operand.ServiceFlavor)
+		case operand.Op == OrOp:
+			for _, leaf := range operand.Operands {
+				if leaf == nil || leaf.Op != "" || leaf.ServiceFlavor == "" {
+					return nil
+				}
+				group = append(group, leaf.ServiceFlavor)
+			}
+		default:
+			return nil
+		}
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// diff lists the fields that differ between two definitions of a profile.
+// Lists are compared and reported in their JSON form. The expression is only
+// reported when one of the definitions cannot be written as groups, the
+// groups tell the change otherwise.
+func diff(before AvailabilityProfileInput, after AvailabilityProfileInput) []ChangeOutput {
+
+	before, after = normalize(before), normalize(after)
+
+	changes := []ChangeOutput{}
+
+	fields := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+	}{
+		{"name", before.Name, after.Name},
+		{"namespace", before.Namespace, after.Namespace},
+		{"groups", before.Groups, after.Groups},
+		{"poems", before.Poems, after.Poems},
+		{"expression", before.Expression, after.Expression},
+	}
+
+	ungrouped := (before.Expression != nil && before.Groups == nil) || (after.Expression != nil && after.Groups == nil)
+
+	for _, field := range fields {
+		if field.name == "expression" && !ungrouped {
+			continue
+		}
+		from, to := jsonString(field.before), jsonString(field.after)
+		if from != to {
+			changes = append(changes, ChangeOutput{field.name, from, to})
+		}
+	}
+
+	return changes
+}
+
+func jsonString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	if e, ok := v.(*Expression); ok && e == nil {
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	if string(data) == "null" {
+		return "[]"
+	}
+	return string(data)
+}
+
+// listFilter selects the profiles matching every filter given
+func listFilter(input AvailabilityProfileFilter) bson.M {
+
+	filter := bson.M{}
+	name := bson.M{}
+
+	if len(input.Name) > 0 {
+		name["$in"] = input.Name
+	}
+
+	if input.NamePrefix != "" {
+		name["$regex"] = "^" + regexp.QuoteMeta(input.NamePrefix)
+	}
+
+	if len(name) > 0 {
+		filter["name"] = name
+	}
+
+	if len(input.Namespace) > 0 {
+		filter["namespace"] = bson.M{"$in": input.Namespace}
+	}
+
+	//Profiles stored before the flavors were kept are searched by their groups
+	if len(input.ServiceFlavor) > 0 {
+		filter["$or"] = []bson.M{
+			{"flavors": bson.M{"$in": input.ServiceFlavor}},
+			{"groups": bson.M{"$elemMatch": bson.M{"$elemMatch": bson.M{"$in": input.ServiceFlavor}}}},
+		}
+	}
+
+	if len(input.Poem) > 0 {
+		filter["poems"] = bson.M{"$in": input.Poem}
+	}
+
+	return filter
+}
+
+// sortFields turns the sort parameter, a comma separated list of fields
+// each optionally prefixed with - for descending order, into the sort of
+// the query. Profiles are sorted by id unless asked otherwise.
+func sortFields(sort string) ([]string, error) {
+
+	fields := []string{}
+
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		order := ""
+		if strings.HasPrefix(field, "-") {
+			order, field = "-", field[1:]
+		}
+		stored, found := sortable[field]
+		if !found {
+			return nil, fmt.Errorf("Cannot sort by %s, use id, name or namespace", field)
+		}
+		fields = append(fields, order+stored)
+	}
+
+	if len(fields) == 0 {
+		fields = append(fields, "_id")
+	}
+
+	return fields, nil
+}
+
+// flavorsOf appends the service flavors of an expression to flavors, each once
+func flavorsOf(expression *Expression, flavors []string) []string {
+	if expression == nil {
+		return flavors
+	}
+	if expression.ServiceFlavor != "" && !contains(flavors, expression.ServiceFlavor) {
+		flavors = append(flavors, expression.ServiceFlavor)
+	}
+	for _, operand := range expression.Operands {
+		flavors = flavorsOf(operand, flavors)
+	}
+	return flavors
+}
+
+// bundleOne returns the definition of a profile as written in bundles, in
+// the form of groups whenever the profile can be written as groups
+func bundleOne(profile AvailabilityProfileOutput) AvailabilityProfileInput {
+	input := inputOf(profile)
+	if input.Groups != nil {
+		input.Expression = nil
+	}
+	return input
+}
+
 func readOne(input AvailabilityProfileSearch) bson.M {
 	filter := prepareFilter(input)
 	return filter
 }
+
+// validate checks a profile against the POEM profiles and the service flavors
+// they monitor, as found in poem_list and poem_details, and returns every
+// problem found
+func validate(input AvailabilityProfileInput, knownPoems []string, knownFlavors []string) []*Problem {
+
+	problems := []*Problem{}
+
+	if input.Name == "" {
+		problems = append(problems, &Problem{Field: "name", Message: "A name is required"})
+	}
+
+	if len(input.Poems) == 0 {
+		problems = append(problems, &Problem{Field: "poems", Message: "At least one POEM profile is required"})
+	}
+
+	for i, poem := range input.Poems {
+		if !contains(knownPoems, poem) {
+			problems = append(problems, &Problem{
+				Field:   fmt.Sprintf("poems[%d]", i),
+				Value:   poem,
+				Message: "No POEM profile named " + poem,
+			})
+		}
+	}
+
+	if input.Expression != nil {
+		problems = append(problems, validateExpression(input.Expression, "expression", 1, knownFlavors)...)
+		if input.Groups != nil && jsonString(groupsOf(input.Expression)) != jsonString(input.Groups) {
+			problems = append(problems, &Problem{Field: "groups", Message: "The groups and the expression describe different profiles"})
+		}
+		return problems
+	}
+
+	if len(input.Groups) == 0 {
+		problems = append(problems, &Problem{Field: "groups", Message: "At least one group is required"})
+	}
+
+	for i, group := range input.Groups {
+		if len(group) == 0 {
+			problems = append(problems, &Problem{
+				Field:   fmt.Sprintf("groups[%d]", i),
+				Message: "A group must list at least one service flavor",
+			})
+		}
+		for j, flavor := range group {
+			if !contains(knownFlavors, flavor) {
+				problems = append(problems, &Problem{
+					Field:   fmt.Sprintf("groups[%d][%d]", i, j),
+					Value:   flavor,
+					Message: "Service flavor " + flavor + " is not monitored by the POEM profiles",
+				})
+			}
+		}
+	}
+
+	return problems
+}
+
+// maxDepth is how deep the operators of an expression may be nested
+const maxDepth = 16
+
+// validateExpression checks a node of an expression and its operands, path
+// telling where the node is found
+func validateExpression(node *Expression, path string, depth int, knownFlavors []string) []*Problem {
+
+	problems := []*Problem{}
+
+	switch node.Op {
+	case "":
+		if node.ServiceFlavor == "" {
+			problems = append(problems, &Problem{Field: path, Message: "An operand must be an operator or a service flavor"})
+		} else if !contains(knownFlavors, node.ServiceFlavor) {
+			problems = append(problems, &Problem{
+				Field:   path,
+				Value:   node.ServiceFlavor,
+				Message: "Service flavor " + node.ServiceFlavor + " is not monitored by the POEM profiles",
+			})
+		}
+		if len(node.Operands) > 0 {
+			problems = append(problems, &Problem{Field: path + ".operands", Message: "A service flavor cannot have operands"})
+		}
+		return problems
+	case AndOp, OrOp, AtLeastOp:
+	default:
+		problems = append(problems, &Problem{
+			Field:   path + ".op",
+			Value:   node.Op,
+			Message: "Unknown operator " + node.Op + ", expected AND, OR or AT_LEAST",
+		})
+		return problems
+	}
+
+	if depth > maxDepth {
+		problems = append(problems, &Problem{Field: path, Message: fmt.Sprintf("Operators can be nested at most %d deep", maxDepth)})
+		return problems
+	}
+
+	if node.ServiceFlavor != "" {
+		problems = append(problems, &Problem{Field: path + ".service_flavor", Value: node.ServiceFlavor, Message: "An operator cannot name a service flavor"})
+	}
+
+	if len(node.Operands) == 0 {
+		problems = append(problems, &Problem{Field: path + ".operands", Message: "An operator must have at least one operand"})
+	}
+
+	if node.Op == AtLeastOp && (node.K < 1 || node.K > len(node.Operands)) {
+		problems = append(problems, &Problem{
+			Field:   path + ".k",
+			Value:   strconv.Itoa(node.K),
+			Message: fmt.Sprintf("AT_LEAST needs a k between 1 and its %d operands", len(node.Operands)),
+		})
+	} else if node.Op != AtLeastOp && node.K != 0 {
+		problems = append(problems, &Problem{Field: path + ".k", Value: strconv.Itoa(node.K), Message: "Only AT_LEAST takes a k"})
+	}
+
+	for i, operand := range node.Operands {
+		field := fmt.Sprintf("%s.operands[%d]", path, i)
+		if operand == nil {
+			problems = append(problems, &Problem{Field: field, Message: "An operand must be an operator or a service flavor"})
+			continue
+		}
+		problems = append(problems, validateExpression(operand, field, depth+1, knownFlavors)...)
+	}
+
+	return problems
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
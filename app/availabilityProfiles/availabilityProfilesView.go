@@ -26,9 +26,12 @@
 
 package availabilityProfiles
 
-import "encoding/xml"
+import (
+	"github.com/argoeu/argo-web-api/utils/render"
+	"time"
+)
 
-func createView(results []AvailabilityProfileOutput) ([]byte, error) {
+func createView(results []AvailabilityProfileOutput, contentType string) interface{} {
 
 	poem_name := ""
 
@@ -47,9 +50,22 @@ func createView(results []AvailabilityProfileOutput) ([]byte, error) {
 			Name:      row.Name,
 			Namespace: row.Namespace,
 			Poem:      poem_name,
+			Revision:  row.Revision,
 		}
-		and := &And{}
 		docRoot.Profile = append(docRoot.Profile, profile)
+
+		//Profiles that cannot be written as groups show their expression instead,
+		//on a single column in CSV
+		if row.Groups == nil && row.Expression != nil {
+			if contentType == render.CSV {
+				profile.Formula = formula(row.Expression)
+			} else {
+				profile.Node = nodeView(row.Expression)
+			}
+			continue
+		}
+
+		and := &And{}
 		for _, group := range row.Groups {
 			or := &Or{}
 			for _, sf := range group {
@@ -62,14 +78,87 @@ func createView(results []AvailabilityProfileOutput) ([]byte, error) {
 		}
 		profile.And = and
 	}
-	output, err := xml.MarshalIndent(docRoot, " ", "  ")
-	return output, err
+	return docRoot
+
+}
+
+func nodeView(expression *Expression) *Node {
+
+	node := &Node{
+		Op:            expression.Op,
+		K:             expression.K,
+		ServiceFlavor: expression.ServiceFlavor,
+	}
+
+	node.XMLName.Local = expression.Op
+	if expression.Op == "" {
+		node.XMLName.Local = "Group"
+	}
+
+	for _, operand := range expression.Operands {
+		node.Node = append(node.Node, nodeView(operand))
+	}
+
+	return node
+}
+
+func historyView(id string, results []RevisionOutput) interface{} {
+
+	docRoot := &HistoryRoot{ID: id}
+
+	for _, row := range results {
+		revision := &Revision{
+			Revision:  row.Revision,
+			Action:    row.Action,
+			Author:    row.Author,
+			Timestamp: row.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+		}
+		for _, change := range row.Changes {
+			revision.Change = append(revision.Change, &Change{
+				Field: change.Field,
+				From:  change.From,
+				To:    change.To,
+			})
+		}
+		docRoot.Revision = append(docRoot.Revision, revision)
+	}
+
+	return docRoot
+}
+
+// bundleView collects the profiles into a bundle, which is written in JSON or,
+// when asked for, YAML
+func bundleView(results []AvailabilityProfileOutput) interface{} {
+
+	bundle := Bundle{
+		Version:  bundleVersion,
+		Exported: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Profiles: []AvailabilityProfileInput{},
+	}
+
+	for _, row := range results {
+		bundle.Profiles = append(bundle.Profiles, bundleOne(row))
+	}
 
+	return bundle
 }
 
-func messageXML(answer string) ([]byte, error) {
+func importView(dryRun bool, imported []*Imported) interface{} {
+	docRoot := &ImportRoot{}
+	docRoot.DryRun = dryRun
+	docRoot.Imported = imported
+	return docRoot
+}
+
+func messageView(answer string) interface{} {
 	docRoot := &Message{}
 	docRoot.Message = answer
-	output, err := xml.MarshalIndent(docRoot, " ", "  ")
-	return output, err
+	return docRoot
+}
+
+func problemView(problems []*Problem) interface{} {
+	docRoot := &ProblemRoot{}
+	docRoot.Message = "Invalid availability profile"
+	docRoot.Problem = problems
+	return docRoot
 }
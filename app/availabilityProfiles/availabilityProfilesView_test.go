@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package availabilityProfiles
+
+import (
+	"github.com/argoeu/argo-web-api/utils/render"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type ViewTestSuite struct {
+	suite.Suite
+	profiles []AvailabilityProfileOutput
+}
+
+// The profile (CREAM-CE OR ARC-CE) AND AT_LEAST(2, SRM, webdav AND xrootd)
+// cannot be written as groups and is rendered from its expression
+func (suite *ViewTestSuite) SetupTest() {
+	suite.profiles = []AvailabilityProfileOutput{{
+		Name:      "nested",
+		Namespace: "vo",
+		Poems:     []string{"poem"},
+		Expression: &Expression{Op: AndOp, Operands: []*Expression{
+			{Op: OrOp, Operands: []*Expression{{ServiceFlavor: "CREAM-CE"}, {ServiceFlavor: "ARC-CE"}}},
+			{Op: AtLeastOp, K: 2, Operands: []*Expression{
+				{ServiceFlavor: "SRM"},
+				{Op: AndOp, Operands: []*Expression{{ServiceFlavor: "webdav"}, {ServiceFlavor: "xrootd"}}},
+			}},
+		}},
+	}}
+}
+
+func (suite *ViewTestSuite) TestExpressionXML() {
+	output, err := render.Marshal(render.XML, createView(suite.profiles, render.XML))
+	suite.Nil(err)
+	suite.Equal(` <root>
+   <profile id="" name="nested" namespace="vo" poems="poem">
+     <expression>
+       <AND>
+         <OR>
+           <Group service_flavor="CREAM-CE"></Group>
+           <Group service_flavor="ARC-CE"></Group>
+         </OR>
+         <AT_LEAST k="2">
+           <Group service_flavor="SRM"></Group>
+           <AND>
+             <Group service_flavor="webdav"></Group>
+             <Group service_flavor="xrootd"></Group>
+           </AND>
+         </AT_LEAST>
+       </AND>
+     </expression>
+   </profile>
+ </root>`, string(output))
+}
+
+func (suite *ViewTestSuite) TestExpressionJSON() {
+	output, err := render.Marshal(render.JSON, createView(suite.profiles, render.JSON))
+	suite.Nil(err)
+	suite.JSONEq(`{"profiles": [{"id": "", "name": "nested", "namespace": "vo", "poems": "poem",
+		"expression": {"op": "AND", "operands": [
+			{"op": "OR", "operands": [{"service_flavor": "CREAM-CE"}, {"service_flavor": "ARC-CE"}]},
+			{"op": "AT_LEAST", "k": 2, "operands": [{"service_flavor": "SRM"},
+				{"op": "AND", "operands": [{"service_flavor": "webdav"}, {"service_flavor": "xrootd"}]}]}]}}]}`, string(output))
+}
+
+func (suite *ViewTestSuite) TestExpressionCSV() {
+	output, err := render.Marshal(render.CSV, createView(suite.profiles, render.CSV))
+	suite.Nil(err)
+	suite.Equal("profile.id,profile.name,profile.namespace,profile.poems,profile.revision,profile.expression\n"+
+		",nested,vo,poem,0,\"(CREAM-CE OR ARC-CE) AND AT_LEAST(2, SRM, (webdav AND xrootd))\"\n", string(output))
+}
+
+func TestViewTestSuite(t *testing.T) {
+	suite.Run(t, new(ViewTestSuite))
+}
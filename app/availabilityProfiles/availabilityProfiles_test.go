@@ -28,9 +28,14 @@ package availabilityProfiles
 
 import (
 	"code.google.com/p/gcfg"
+	"encoding/json"
+	"github.com/argoeu/argo-web-api/utils/authentication"
+	"github.com/argoeu/argo-web-api/utils/caches"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"github.com/stretchr/testify/suite"
+	"gopkg.in/yaml.v3"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"net/http"
@@ -47,6 +52,7 @@ type AvProfileTestSuite struct {
 	resp_profileDeleted string
 	resp_unauthorized   string
 	resp_no_id          string
+	resp_bad_id         string
 	resp_bad_json       string
 }
 
@@ -84,20 +90,26 @@ func (suite *AvProfileTestSuite) SetupTest() {
 	suite.resp_profileDeleted = " <root>\n" +
 		"   <Message>Availability Profile was successfully deleted</Message>\n </root>"
 
-	suite.resp_unauthorized = "Unauthorized"
+	suite.resp_unauthorized = " <root>\n" +
+		"   <Message>Unauthorized</Message>\n </root>"
 
 	suite.resp_no_id = " <root>\n" +
 		"   <Message>No profile matching the requested id</Message>\n </root>"
 
+	suite.resp_bad_id = " <root>\n" +
+		"   <Message>Malformed profile id</Message>\n </root>"
+
 	suite.resp_bad_json = " <root>\n" +
 		"   <Message>Malformated json input data</Message>\n </root>"
 
 	// Connect to mongo testdb
 	session, _ := mongo.OpenSession(suite.cfg)
 
-	// Add authentication token to mongo testdb
+	// Add authentication token to mongo testdb and hash it the way
+	// the server does at startup
 	seed_auth := bson.M{"apiKey": "S3CR3T"}
 	_ = mongo.Insert(session, suite.cfg.MongoDB.Db, "authentication", seed_auth)
+	_, _ = authentication.MigrateKeys(suite.cfg)
 
 	// seed mongo
 	session, err := mgo.Dial(suite.cfg.MongoDB.Host)
@@ -106,6 +118,22 @@ func (suite *AvProfileTestSuite) SetupTest() {
 	}
 	defer session.Close()
 
+	// Seed the POEM profiles and the service flavors they monitor,
+	// which the created and updated profiles are validated against
+	pl := session.DB(suite.cfg.MongoDB.Db).C("poem_list")
+	pd := session.DB(suite.cfg.MongoDB.Db).C("poem_details")
+	poems := map[string][]string{
+		"test_poem": []string{"service1", "service2", "service3", "service4", "service5", "service6"},
+		"updated-ap2-poem": []string{"updated-srv1", "updated-srv2", "updated-srv3",
+			"updated-srv4", "updated-srv5", "updated-srv6"},
+	}
+	for poem, flavors := range poems {
+		pl.Insert(bson.M{"p": poem})
+		for _, flavor := range flavors {
+			pd.Insert(bson.M{"p": poem, "s": flavor, "m": flavor + "-metric"})
+		}
+	}
+
 	// Insert first seed profile
 	c := session.DB(suite.cfg.MongoDB.Db).C("aps")
 	c.Insert(bson.M{"name": "ap1", "namespace": "namespace1", "poems": []string{"poem01"},
@@ -159,7 +187,7 @@ func (suite *AvProfileTestSuite) TestCreateProfile() {
 	code, _, output, _ := Create(request, suite.cfg)
 
 	suite.Equal(200, code, "Internal Server Error")
-	suite.Equal(suite.resp_profileCreated, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_profileCreated, string(body(request, output)), "Response body mismatch")
 
 	// Remove the profile not to contaminate other tests
 	// Open session to mongo
@@ -175,6 +203,65 @@ func (suite *AvProfileTestSuite) TestCreateProfile() {
 
 }
 
+// Testing creation of a profile defined by an expression that cannot be
+// written as groups. The profile is stored without groups and read back
+// with its expression.
+func (suite *AvProfileTestSuite) TestCreateExpressionProfile() {
+
+	post_data := `{"name": "expression_profile", "namespace": "test_namespace", "poems": ["test_poem"],
+        "expression": {"op": "AND", "operands": [
+            {"op": "OR", "operands": [{"service_flavor": "service1"}, {"service_flavor": "service2"}]},
+            {"op": "AT_LEAST", "k": 2, "operands": [{"service_flavor": "service3"}, {"service_flavor": "service4"},
+                {"op": "AND", "operands": [{"service_flavor": "service5"}, {"service_flavor": "service6"}]}]}]}}`
+
+	request, _ := http.NewRequest("POST", "", strings.NewReader(post_data))
+	request.Header.Set("Content-Type", "application/json;")
+	request.Header.Set("x-api-key", "S3CR3T")
+
+	code, _, output, _ := Create(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	suite.Equal(suite.resp_profileCreated, string(body(request, output)), "Response body mismatch")
+
+	session, err := mgo.Dial(suite.cfg.MongoDB.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+	c := session.DB(suite.cfg.MongoDB.Db).C("aps")
+	results := AvailabilityProfileOutput{}
+	c.Find(bson.M{"name": "expression_profile"}).One(&results)
+	suite.Nil(results.Groups)
+	suite.Equal(AtLeastOp, results.Expression.Operands[1].Op)
+
+	profile_xml := ` <root>
+   <profile id="` + results.ID.Hex() + `" name="expression_profile" namespace="test_namespace" poems="test_poem" revision="1">
+     <expression>
+       <AND>
+         <OR>
+           <Group service_flavor="service1"></Group>
+           <Group service_flavor="service2"></Group>
+         </OR>
+         <AT_LEAST k="2">
+           <Group service_flavor="service3"></Group>
+           <Group service_flavor="service4"></Group>
+           <AND>
+             <Group service_flavor="service5"></Group>
+             <Group service_flavor="service6"></Group>
+           </AND>
+         </AT_LEAST>
+       </AND>
+     </expression>
+   </profile>
+ </root>`
+
+	request, _ = http.NewRequest("GET", "/api/v1/AP/"+results.ID.Hex(), strings.NewReader(""))
+	code, _, output, _ = ListOne(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	suite.Equal(profile_xml, string(body(request, output)), "Response body mismatch")
+
+	c.Remove(bson.M{"name": "expression_profile"})
+}
+
 // Testing Reading of profile list using GET request.
 // During Setup of the test environment the testdb is seeded with
 // two availability profiles ("ap1","ap2"). Mongo assigns
@@ -240,7 +327,360 @@ func (suite *AvProfileTestSuite) TestReadProfile() {
 	// Check that we must have a 200 ok code
 	suite.Equal(200, code, "Internal Server Error")
 	// Compare the expected and actual xml response
-	suite.Equal(profile_list_xml, string(output), "Response body mismatch")
+	suite.Equal(profile_list_xml, string(body(request, output)), "Response body mismatch")
+}
+
+// Testing the filters, sorting and paging of the profile list. Each
+// filter applies on its own and the total count of matching profiles
+// is returned whatever the page.
+func (suite *AvProfileTestSuite) TestListFilters() {
+
+	tests := []struct {
+		query string
+		names []string
+		total string
+	}{
+		{"namespace=namespace2", []string{"ap2"}, "1"},
+		{"name=ap1", []string{"ap1"}, "1"},
+		{"name_prefix=ap", []string{"ap1", "ap2"}, "2"},
+		{"service_flavor=ap1-service5", []string{"ap1"}, "1"},
+		{"poem=poem02", []string{"ap2"}, "1"},
+		{"sort=-name", []string{"ap2", "ap1"}, "2"},
+		{"sort=name&limit=1&offset=1", []string{"ap2"}, "2"},
+		{"namespace=namespace1&poem=poem02", []string{}, "0"},
+	}
+
+	for _, test := range tests {
+		request, _ := http.NewRequest("GET", "/api/v1/AP?"+test.query, strings.NewReader(""))
+		request.Header.Set("Accept", "application/json")
+		code, header, output, _ := List(request, suite.cfg)
+		suite.Equal(200, code, "Internal Server Error")
+		suite.Equal(test.total, header.Get("X-Total-Count"), test.query)
+
+		list := struct{ Profiles []struct{ Name string } }{}
+		json.Unmarshal(body(request, output), &list)
+		names := []string{}
+		for _, profile := range list.Profiles {
+			names = append(names, profile.Name)
+		}
+		suite.Equal(test.names, names, test.query)
+	}
+
+	for _, query := range []string{"sort=poems", "limit=-1", "offset=two"} {
+		request, _ := http.NewRequest("GET", "/api/v1/AP?"+query, strings.NewReader(""))
+		code, _, _, _ := List(request, suite.cfg)
+		suite.Equal(400, code, query)
+	}
+}
+
+// Testing reading of a single profile by id using GET request.
+// The seeded profile ap1 is returned on its own, while a well formed
+// id that matches no profile is answered with not found and a
+// malformed one with bad request.
+func (suite *AvProfileTestSuite) TestReadOneProfile() {
+
+	// Open a session to mongo
+	session, err := mgo.Dial(suite.cfg.MongoDB.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+	// Open availability profile collection: aps
+	c := session.DB(suite.cfg.MongoDB.Db).C("aps")
+	// Instantiate a AvProfile struct to hold bson results
+	results := AvailabilityProfileOutput{}
+	// Query first seed profile - name:ap1
+	c.Find(bson.M{"name": "ap1"}).One(&results)
+	// Grab from results ObjectId and convert it to string: Hex() method
+	id1 := (results.ID.Hex())
+
+	profile_xml := ` <root>
+   <profile id="` + id1 + `" name="ap1" namespace="namespace1" poems="poem01">
+     <AND>
+       <OR>
+         <Group service_flavor="ap1-service1"></Group>
+         <Group service_flavor="ap1-service2"></Group>
+         <Group service_flavor="ap1-service3"></Group>
+       </OR>
+       <OR>
+         <Group service_flavor="ap1-service4"></Group>
+         <Group service_flavor="ap1-service5"></Group>
+         <Group service_flavor="ap1-service6"></Group>
+       </OR>
+     </AND>
+   </profile>
+ </root>`
+
+	request, _ := http.NewRequest("GET", "/api/v1/AP/"+id1, strings.NewReader(""))
+	code, _, output, _ := ListOne(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	suite.Equal(profile_xml, string(body(request, output)), "Response body mismatch")
+
+	request, _ = http.NewRequest("GET", "/api/v1/AP/"+bson.NewObjectId().Hex(), strings.NewReader(""))
+	code, _, output, _ = ListOne(request, suite.cfg)
+	suite.Equal(404, code, "Internal Server Error")
+	suite.Equal(suite.resp_no_id, string(body(request, output)), "Response body mismatch")
+
+	request, _ = http.NewRequest("GET", "/api/v1/AP/wrongid", strings.NewReader(""))
+	code, _, output, _ = ListOne(request, suite.cfg)
+	suite.Equal(400, code, "Internal Server Error")
+	suite.Equal(suite.resp_bad_id, string(body(request, output)), "Response body mismatch")
+}
+
+// Testing the revisions of a profile. Updating the seeded profile ap2
+// records its original definition as revision 1 and the update as
+// revision 2, and rolling back to revision 1 restores it as revision 3.
+func (suite *AvProfileTestSuite) TestProfileHistory() {
+
+	put_data := `{"name": "updated-ap2", "namespace": "namespace2", "poems": ["updated-ap2-poem"],
+        "groups": [["updated-srv1", "updated-srv2"]]}`
+
+	session, err := mgo.Dial(suite.cfg.MongoDB.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+	c := session.DB(suite.cfg.MongoDB.Db).C("aps")
+	results := AvailabilityProfileOutput{}
+	c.Find(bson.M{"name": "ap2"}).One(&results)
+	id2 := (results.ID.Hex())
+
+	request, _ := http.NewRequest("PUT", "/api/v1/AP/"+id2, strings.NewReader(put_data))
+	request.Header.Set("x-api-key", "S3CR3T")
+	code, _, _, _ := Update(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+
+	request, _ = http.NewRequest("GET", "/api/v1/AP/"+id2+"/history", strings.NewReader(""))
+	request.Header.Set("Accept", "application/json")
+	code, _, output, _ := History(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+
+	history := struct {
+		Revisions []struct {
+			Revision int
+			Action   string
+			Changes  []struct{ Field, From, To string }
+		}
+	}{}
+	json.Unmarshal(body(request, output), &history)
+	suite.Equal(2, len(history.Revisions))
+	suite.Equal("baseline", history.Revisions[0].Action)
+	suite.Equal("update", history.Revisions[1].Action)
+	suite.Equal(3, len(history.Revisions[1].Changes))
+	suite.Equal("name", history.Revisions[1].Changes[0].Field)
+	suite.Equal("ap2", history.Revisions[1].Changes[0].From)
+	suite.Equal("updated-ap2", history.Revisions[1].Changes[0].To)
+
+	request, _ = http.NewRequest("POST", "/api/v1/AP/"+id2+"/rollback?revision=1", strings.NewReader(""))
+	request.Header.Set("x-api-key", "S3CR3T")
+	code, _, output, _ = Rollback(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	suite.Equal(" <root>\n   <Message>Availability Profile was rolled back to revision 1</Message>\n </root>", string(body(request, output)))
+
+	c.FindId(results.ID).One(&results)
+	suite.Equal("ap2", results.Name)
+	suite.Equal(3, results.Revision)
+
+	request, _ = http.NewRequest("GET", "/api/v1/AP/"+id2+"?revision=2", strings.NewReader(""))
+	code, _, output, _ = ListOne(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	suite.Contains(string(body(request, output)), `name="updated-ap2" namespace="namespace2" poems="updated-ap2-poem" revision="2"`)
+
+	request, _ = http.NewRequest("POST", "/api/v1/AP/"+id2+"/rollback?revision=9", strings.NewReader(""))
+	request.Header.Set("x-api-key", "S3CR3T")
+	code, _, _, _ = Rollback(request, suite.cfg)
+	suite.Equal(404, code, "Internal Server Error")
+}
+
+// Testing partial update of a profile using PATCH requests, with
+// either a merge patch or a JSON patch. The ETag read before the
+// patch must be refused afterwards and patches that touch the
+// revision of the profile are rejected.
+func (suite *AvProfileTestSuite) TestPatchProfile() {
+
+	session, err := mgo.Dial(suite.cfg.MongoDB.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+	c := session.DB(suite.cfg.MongoDB.Db).C("aps")
+	results := AvailabilityProfileOutput{}
+	c.Find(bson.M{"name": "ap2"}).One(&results)
+	id2 := (results.ID.Hex())
+
+	request, _ := http.NewRequest("GET", "/api/v1/AP/"+id2, strings.NewReader(""))
+	code, header, _, _ := ListOne(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	etag := header.Get("ETag")
+	suite.Equal(`"`+id2+`-0"`, etag)
+
+	request, _ = http.NewRequest("PATCH", "/api/v1/AP/"+id2, strings.NewReader(`{"name": "patched-ap2"}`))
+	request.Header.Set("x-api-key", "S3CR3T")
+	request.Header.Set("If-Match", etag)
+	code, header, output, _ := Patch(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	suite.Equal(" <root>\n   <Message>Availability Profile was successfully updated</Message>\n </root>", string(body(request, output)))
+	suite.Equal(`"`+id2+`-2"`, header.Get("ETag"))
+
+	c.FindId(results.ID).One(&results)
+	suite.Equal("patched-ap2", results.Name)
+	suite.Equal("namespace2", results.Namespace)
+
+	//The tag read before the patch is stale by now
+	request, _ = http.NewRequest("PATCH", "/api/v1/AP/"+id2, strings.NewReader(`[{"op": "replace", "path": "/name", "value": "ap2"}]`))
+	request.Header.Set("x-api-key", "S3CR3T")
+	request.Header.Set("Content-Type", "application/json-patch+json")
+	request.Header.Set("If-Match", etag)
+	code, _, _, _ = Patch(request, suite.cfg)
+	suite.Equal(412, code, "Internal Server Error")
+
+	request, _ = http.NewRequest("PATCH", "/api/v1/AP/"+id2, strings.NewReader(`{"revision": 7}`))
+	request.Header.Set("x-api-key", "S3CR3T")
+	code, _, _, _ = Patch(request, suite.cfg)
+	suite.Equal(400, code, "Internal Server Error")
+}
+
+// Testing that an update or a patch cannot give a profile the name and
+// namespace of another one
+func (suite *AvProfileTestSuite) TestRenameClash() {
+
+	session, err := mgo.Dial(suite.cfg.MongoDB.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+	c := session.DB(suite.cfg.MongoDB.Db).C("aps")
+	results := AvailabilityProfileOutput{}
+	c.Find(bson.M{"name": "ap2"}).One(&results)
+	id2 := (results.ID.Hex())
+
+	put_data := `{"name": "ap1", "namespace": "namespace1", "poems": ["test_poem"], "groups": [["service1"], ["service2"]]}`
+	request, _ := http.NewRequest("PUT", "/api/v1/AP/"+id2, strings.NewReader(put_data))
+	request.Header.Set("Content-Type", "application/json;")
+	request.Header.Set("x-api-key", "S3CR3T")
+	code, _, output, _ := Update(request, suite.cfg)
+	suite.Equal(409, code, "Internal Server Error")
+	suite.Equal(" <root>\n   <Message>An availability profile with that name already exists</Message>\n </root>", string(body(request, output)))
+
+	request, _ = http.NewRequest("PATCH", "/api/v1/AP/"+id2, strings.NewReader(`{"name": "ap1", "namespace": "namespace1"}`))
+	request.Header.Set("x-api-key", "S3CR3T")
+	code, _, _, _ = Patch(request, suite.cfg)
+	suite.Equal(409, code, "Internal Server Error")
+
+	count, _ := c.Find(bson.M{"name": "ap1", "namespace": "namespace1"}).Count()
+	suite.Equal(1, count)
+}
+
+// Testing import and export of bundles. A dry run reports the profile
+// as to be created without creating it, the import creates it, importing
+// the bundle again leaves it untouched and the export writes it back.
+func (suite *AvProfileTestSuite) TestImportExport() {
+
+	bundle_yaml := `version: 1
+profiles:
+  - name: imported
+    namespace: bundle_namespace
+    poems: [test_poem]
+    groups: [[service1, service2], [service3]]
+`
+
+	imported := struct {
+		DryRun   bool `json:"dry_run"`
+		Profiles []struct{ Name, Action string }
+	}{}
+
+	request, _ := http.NewRequest("POST", "/api/v1/AP/import?dry_run=true", strings.NewReader(bundle_yaml))
+	request.Header.Set("Content-Type", "application/x-yaml")
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("x-api-key", "S3CR3T")
+	code, _, output, _ := Import(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	json.Unmarshal(body(request, output), &imported)
+	suite.True(imported.DryRun)
+	suite.Equal("create", imported.Profiles[0].Action)
+
+	session, err := mgo.Dial(suite.cfg.MongoDB.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+	c := session.DB(suite.cfg.MongoDB.Db).C("aps")
+	count, _ := c.Find(bson.M{"name": "imported"}).Count()
+	suite.Equal(0, count)
+
+	for _, action := range []string{"create", "unchanged"} {
+		request, _ = http.NewRequest("POST", "/api/v1/AP/import", strings.NewReader(bundle_yaml))
+		request.Header.Set("Content-Type", "application/x-yaml")
+		request.Header.Set("Accept", "application/json")
+		request.Header.Set("x-api-key", "S3CR3T")
+		code, _, output, _ = Import(request, suite.cfg)
+		suite.Equal(200, code, "Internal Server Error")
+		json.Unmarshal(body(request, output), &imported)
+		suite.False(imported.DryRun)
+		suite.Equal(action, imported.Profiles[0].Action)
+	}
+
+	request, _ = http.NewRequest("GET", "/api/v1/AP/export?namespace=bundle_namespace", strings.NewReader(""))
+	request = render.WithContentType(request, render.JSON)
+	code, header, output, _ := Export(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	suite.Equal(`attachment; filename="profiles.json"`, header.Get("Content-Disposition"))
+	exported := Bundle{}
+	json.Unmarshal(body(request, output), &exported)
+	suite.Equal(1, len(exported.Profiles))
+	suite.Equal([][]string{{"service1", "service2"}, {"service3"}}, exported.Profiles[0].Groups)
+
+	request = render.WithContentType(request, render.YAML)
+	code, header, output, _ = Export(request, suite.cfg)
+	suite.Equal(200, code, "Internal Server Error")
+	suite.Equal(`attachment; filename="profiles.yaml"`, header.Get("Content-Disposition"))
+	exported = Bundle{}
+	yaml.Unmarshal(body(request, output), &exported)
+	suite.Equal(1, len(exported.Profiles))
+	suite.Equal([][]string{{"service1", "service2"}, {"service3"}}, exported.Profiles[0].Groups)
+
+	c.Remove(bson.M{"name": "imported"})
+}
+
+// Testing an import that stops half way. The profiles written before the
+// conflict stay written and the cached availability reports are purged.
+func (suite *AvProfileTestSuite) TestImportPartial() {
+
+	cfg := suite.cfg
+	cfg.Server.Cache = true
+	caches.WriteCache("sites", "report", []byte("<root/>"), cfg)
+
+	session, err := mgo.Dial(suite.cfg.MongoDB.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+	c := session.DB(suite.cfg.MongoDB.Db).C("aps")
+
+	stale := AvailabilityProfileOutput{}
+	c.Find(bson.M{"name": "ap1"}).One(&stale)
+	stale.Revision = 42
+
+	first := AvailabilityProfileInput{Name: "imported_first", Namespace: "bundle_namespace", Poems: []string{"test_poem"}, Groups: [][]string{{"service1"}}}
+	second := inputOf(stale)
+	second.Poems = []string{"test_poem"}
+
+	steps := []importStep{
+		{result: &Imported{Action: "create"}, input: first},
+		{result: &Imported{Action: "update"}, input: second, before: stale},
+	}
+
+	repo := mongo.NewRepository(session, suite.cfg)
+	written, err := importProfiles(cfg, repo, steps, "tester")
+
+	suite.Equal(1, written)
+	suite.Equal(mgo.ErrNotFound, err)
+	count, _ := c.Find(bson.M{"name": "imported_first"}).Count()
+	suite.Equal(1, count)
+	found, _, _ := caches.Lookup("sites", "report", cfg)
+	suite.False(found)
+
+	c.Remove(bson.M{"name": "imported_first"})
 }
 
 // Testing update of a profile  using POST request.
@@ -297,7 +737,7 @@ func (suite *AvProfileTestSuite) TestUpdateProfile() {
 	code, _, output, _ := Update(request, suite.cfg)
 
 	suite.Equal(200, code, "Internal Server Error")
-	suite.Equal(suite.resp_profileUpdated, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_profileUpdated, string(body(request, output)), "Response body mismatch")
 
 	// Reestablish ap2 profile (remove and reinsert)
 	c.Remove(bson.M{"name": "ap2"})
@@ -368,7 +808,7 @@ func (suite *AvProfileTestSuite) TestDeleteProfile() {
 	code, _, output, _ := Delete(request, suite.cfg)
 	// Check proper response that the profile successfully deleted
 	suite.Equal(200, code, "Internal Server Error")
-	suite.Equal(suite.resp_profileDeleted, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_profileDeleted, string(body(request, output)), "Response body mismatch")
 
 	// Double-check that the profile is actually missing from the profile list
 	request, _ = http.NewRequest("GET", "", strings.NewReader(""))
@@ -378,7 +818,7 @@ func (suite *AvProfileTestSuite) TestDeleteProfile() {
 	// Check that we must have a 200 ok code
 	suite.Equal(200, code, "Internal Server Error")
 	// Compare the expected and actual xml response
-	suite.Equal(profile_list_xml, string(output), "Response body mismatch")
+	suite.Equal(profile_list_xml, string(body(request, output)), "Response body mismatch")
 
 	// Reestablish ap2 profile (reinsert)
 	c.Insert(bson.M{"name": "ap2", "namespace": "namespace2", "poems": []string{"poem02"},
@@ -402,7 +842,7 @@ func (suite *AvProfileTestSuite) TestCreateUnauthorized() {
 	code, _, output, _ := Create(request, suite.cfg)
 
 	suite.Equal(401, code, "Internal Server Error")
-	suite.Equal(suite.resp_unauthorized, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_unauthorized, string(body(request, output)), "Response body mismatch")
 }
 
 // This function tests calling the update profile request (PUT) and providing
@@ -419,7 +859,7 @@ func (suite *AvProfileTestSuite) TestUpdateUnauthorized() {
 	code, _, output, _ := Update(request, suite.cfg)
 
 	suite.Equal(401, code, "Internal Server Error")
-	suite.Equal(suite.resp_unauthorized, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_unauthorized, string(body(request, output)), "Response body mismatch")
 }
 
 // This function tests calling the remove av.profile request (DELETE) and providing
@@ -436,11 +876,11 @@ func (suite *AvProfileTestSuite) TestDeleteUnauthorized() {
 	code, _, output, _ := Delete(request, suite.cfg)
 
 	suite.Equal(401, code, "Internal Server Error")
-	suite.Equal(suite.resp_unauthorized, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_unauthorized, string(body(request, output)), "Response body mismatch")
 }
 
 // This function tests calling the update av.profile request (PUT) and providing
-// a wrong profile id. The response should be profile with id doesn't exist
+// a malformed profile id. The response should be malformed profile id
 func (suite *AvProfileTestSuite) TestUpdateBadId() {
 	// Prepare the request object
 	request, _ := http.NewRequest("PUT", "/api/v1/AP/wrongid", strings.NewReader("{}"))
@@ -453,11 +893,11 @@ func (suite *AvProfileTestSuite) TestUpdateBadId() {
 	code, _, output, _ := Update(request, suite.cfg)
 
 	suite.Equal(400, code, "Internal Server Error")
-	suite.Equal(suite.resp_no_id, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_bad_id, string(body(request, output)), "Response body mismatch")
 }
 
 // This function tests calling the update av.profile request (DELETE) and providing
-// a wrong profile id. The response should be profile with id doesn't exist
+// a malformed profile id. The response should be malformed profile id
 func (suite *AvProfileTestSuite) TestDeleteBadId() {
 	// Prepare the request object
 	request, _ := http.NewRequest("DELETE", "/api/v1/AP/wrongid", strings.NewReader("{}"))
@@ -470,7 +910,50 @@ func (suite *AvProfileTestSuite) TestDeleteBadId() {
 	code, _, output, _ := Delete(request, suite.cfg)
 
 	suite.Equal(400, code, "Internal Server Error")
-	suite.Equal(suite.resp_no_id, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_bad_id, string(body(request, output)), "Response body mismatch")
+}
+
+// This function tests calling the create av.profile request (POST) and providing
+// a profile listing an unknown POEM profile and service flavor. The response
+// should list both problems
+func (suite *AvProfileTestSuite) TestCreateInvalidProfile() {
+
+	post_data := `{"name": "invalid", "namespace": "test_namespace", "poems": ["test_poem", "no_poem"],
+        "groups": [["service1", "no_service"], []]}`
+
+	request, _ := http.NewRequest("POST", "", strings.NewReader(post_data))
+	request.Header.Set("Content-Type", "application/json;")
+	request.Header.Set("x-api-key", "S3CR3T")
+
+	code, _, output, _ := Create(request, suite.cfg)
+
+	problems_xml := ` <root>
+   <Message>Invalid availability profile</Message>
+   <Problem field="poems[1]" value="no_poem">No POEM profile named no_poem</Problem>
+   <Problem field="groups[0][1]" value="no_service">Service flavor no_service is not monitored by the POEM profiles</Problem>
+   <Problem field="groups[1]">A group must list at least one service flavor</Problem>
+ </root>`
+
+	suite.Equal(422, code, "Internal Server Error")
+	suite.Equal(problems_xml, string(body(request, output)), "Response body mismatch")
+
+	post_data = `{"name": "invalid", "namespace": "test_namespace", "poems": ["test_poem"],
+        "expression": {"op": "AT_LEAST", "k": 3, "operands": [{"service_flavor": "service1"}, {"op": "XOR"}]}}`
+
+	request, _ = http.NewRequest("POST", "", strings.NewReader(post_data))
+	request.Header.Set("Content-Type", "application/json;")
+	request.Header.Set("x-api-key", "S3CR3T")
+
+	code, _, output, _ = Create(request, suite.cfg)
+
+	problems_xml = ` <root>
+   <Message>Invalid availability profile</Message>
+   <Problem field="expression.k" value="3">AT_LEAST needs a k between 1 and its 2 operands</Problem>
+   <Problem field="expression.operands[1].op" value="XOR">Unknown operator XOR, expected AND, OR or AT_LEAST</Problem>
+ </root>`
+
+	suite.Equal(422, code, "Internal Server Error")
+	suite.Equal(problems_xml, string(body(request, output)), "Response body mismatch")
 }
 
 // This function tests calling the create av.profile request (POST) and providing
@@ -503,7 +986,7 @@ func (suite *AvProfileTestSuite) TestCreateBadJson() {
 	code, _, output, _ := Create(request, suite.cfg)
 
 	suite.Equal(400, code, "Internal Server Error")
-	suite.Equal(suite.resp_bad_json, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_bad_json, string(body(request, output)), "Response body mismatch")
 }
 
 // This function tests calling the update av.profile request (PUT) and providing
@@ -535,7 +1018,7 @@ func (suite *AvProfileTestSuite) TestUpdateBadJson() {
 	code, _, output, _ := Update(request, suite.cfg)
 
 	suite.Equal(400, code, "Internal Server Error")
-	suite.Equal(suite.resp_bad_json, string(output), "Response body mismatch")
+	suite.Equal(suite.resp_bad_json, string(body(request, output)), "Response body mismatch")
 }
 
 // This function is actually called in the end of all tests
@@ -549,6 +1032,12 @@ func (suite *AvProfileTestSuite) TearDownTest() {
 
 }
 
+// body renders what a handler returned the way Respond does
+func body(request *http.Request, output interface{}) []byte {
+	rendered, _ := render.Output(render.FromRequest(request), output)
+	return rendered
+}
+
 // This is the first function called when go test is issued
 func TestAvProfileTestSuite(t *testing.T) {
 	suite.Run(t, new(AvProfileTestSuite))
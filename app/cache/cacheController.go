@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package cache
+
+import (
+	"fmt"
+	"github.com/argoeu/argo-web-api/utils/authentication"
+	"github.com/argoeu/argo-web-api/utils/caches"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"net/http"
+)
+
+// List reports the usage of the response cache
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	if _, code = authentication.Authorize(r, cfg, authentication.Read); code == http.StatusOK {
+
+		output = createView(caches.Statistics(cfg)) //Respond renders the statistics into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+// Delete purges the cached responses of the regions given by the region
+// parameter, or the whole cache when none is given
+func Delete(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	if _, code = authentication.Authorize(r, cfg, authentication.Admin); code == http.StatusOK {
+
+		purged := caches.Purge(cfg, r.URL.Query()["region"]...)
+
+		message := fmt.Sprintf("%d cached responses purged", purged)
+		if cfg.Server.Cache == false {
+			message = "No caching is active"
+		}
+
+		output = messageView(message) //Respond renders the response into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package cache
+
+import (
+	"encoding/xml"
+)
+
+type Region struct {
+	XMLName xml.Name `xml:"Region" json:"-"`
+	Name    string   `xml:"name,attr" json:"name"`
+	Entries int      `xml:"entries,attr" json:"entries"`
+	Hits    uint64   `xml:"hits,attr" json:"hits"`
+	Misses  uint64   `xml:"misses,attr" json:"misses"`
+	TTL     int      `xml:"ttl,attr" json:"ttl"` // seconds
+}
+
+type root struct {
+	XMLName  xml.Name  `xml:"root" json:"-"`
+	Enabled  bool      `xml:"enabled,attr" json:"enabled"`
+	Backend  string    `xml:"backend,attr" json:"backend"`
+	Length   uint64    `xml:"length,attr" json:"length"`
+	Size     uint64    `xml:"size,attr" json:"size"`
+	Capacity uint64    `xml:"capacity,attr" json:"capacity"`
+	Region   []*Region `json:"regions"`
+}
+
+type Message struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
+}
@@ -27,11 +27,10 @@
 package factors
 
 import (
-	"encoding/xml"
 	"fmt"
 )
 
-func createView(results []FactorsOutput) ([]byte, error) {
+func createView(results []FactorsOutput) interface{} {
 
 	docRoot := &root{}
 
@@ -42,7 +41,6 @@ func createView(results []FactorsOutput) ([]byte, error) {
 		docRoot.Factor = append(docRoot.Factor, f)
 	}
 
-	output, err := xml.MarshalIndent(docRoot, "", " ")
-	return output, err
+	return docRoot
 
 }
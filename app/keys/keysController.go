@@ -0,0 +1,362 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package keys
+
+import (
+	"encoding/json"
+	"github.com/argoeu/argo-web-api/utils/authentication"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"github.com/argoeu/argo-web-api/utils/mongo"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// List returns every API key, without their secrets
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	if _, code = authentication.Authorize(r, cfg, authentication.Admin); code == http.StatusOK {
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		results := []authentication.Auth{}
+		err = repo.Find("authentication", nil, "_id", &results)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		output = createView(results) //Respond renders the results into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+// Create stores a new API key and returns it along with its secret, which
+// cannot be retrieved again
+func Create(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	message := ""
+
+	if _, code = authentication.Authorize(r, cfg, authentication.Admin); code == http.StatusOK {
+
+		//Reading the json input
+		reqBody, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		input := KeyInput{}
+		err = json.Unmarshal(reqBody, &input)
+
+		if err != nil {
+			message = "Malformated json input data" // User provided malformed json input data
+		}
+
+		expires := time.Time{}
+
+		if message == "" {
+			expires, message = validate(input)
+		}
+
+		if message != "" {
+			output = messageView(message)
+
+			code = http.StatusBadRequest
+			return code, h, output, err
+		}
+
+		secret, salt, hash, err := authentication.NewSecret()
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		id := bson.NewObjectId()
+		err = repo.Insert("authentication", createOne(id, input, expires, salt, hash))
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		results := []authentication.Auth{}
+		err = repo.Find("authentication", readOne(id.Hex()), "_id", &results)
+
+		if err != nil || len(results) == 0 {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		output = secretView(results[0], secret) //Respond renders the key into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+// Rotate replaces the secret of a key and returns the new one. Plaintext keys
+// are hashed in the process.
+func Rotate(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	if _, code = authentication.Authorize(r, cfg, authentication.Admin); code == http.StatusOK {
+
+		//Extracting record id from url
+		id := strings.Split(r.URL.Path, "/")[4]
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		code, output, err = lookup(repo, id)
+
+		if code != http.StatusOK {
+			return code, h, output, err
+		}
+
+		secret, salt, hash, err := authentication.NewSecret()
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		err = repo.IdUpdate("authentication", id, rotateOne(salt, hash))
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		results := []authentication.Auth{}
+		err = repo.Find("authentication", readOne(id), "_id", &results)
+
+		if err != nil || len(results) == 0 {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		output = secretView(results[0], secret) //Respond renders the key into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+// Disable revokes a key while keeping its record
+func Disable(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	if _, code = authentication.Authorize(r, cfg, authentication.Admin); code == http.StatusOK {
+
+		//Extracting record id from url
+		id := strings.Split(r.URL.Path, "/")[4]
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		code, output, err = lookup(repo, id)
+
+		if code != http.StatusOK {
+			return code, h, output, err
+		}
+
+		err = repo.IdUpdate("authentication", id, disableOne())
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		output = messageView("API key was successfully disabled") //Respond renders the response into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+// Delete removes a key
+func Delete(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
+
+	//STANDARD DECLARATIONS START
+
+	code := http.StatusOK
+	h := http.Header{}
+	output := interface{}(nil)
+	err := error(nil)
+
+	//STANDARD DECLARATIONS END
+
+	if _, code = authentication.Authorize(r, cfg, authentication.Admin); code == http.StatusOK {
+
+		//Extracting record id from url
+		id := strings.Split(r.URL.Path, "/")[4]
+
+		session, err := mongo.OpenSession(cfg)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
+		code, output, err = lookup(repo, id)
+
+		if code != http.StatusOK {
+			return code, h, output, err
+		}
+
+		err = repo.IdRemove("authentication", id)
+
+		if err != nil {
+			code = http.StatusInternalServerError
+			return code, h, output, err
+		}
+
+		output = messageView("API key was successfully deleted") //Respond renders the response into the negotiated format
+
+		return code, h, output, err
+
+	} else {
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
+		return code, h, output, err
+	}
+}
+
+// lookup checks that a key with the given id exists, rendering the message
+// for the user when it does not
+func lookup(repo *mongo.Repository, id string) (int, interface{}, error) {
+
+	if !bson.IsObjectIdHex(id) {
+		return http.StatusBadRequest, messageView("Malformed key id"), nil
+	}
+
+	results := []authentication.Auth{}
+	err := repo.Find("authentication", readOne(id), "_id", &results)
+
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	if len(results) == 0 {
+		return http.StatusNotFound, messageView("No key matching the requested id"), nil
+	}
+
+	return http.StatusOK, nil, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package keys
+
+import (
+	"encoding/xml"
+	"github.com/argoeu/argo-web-api/utils/authentication"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+type Key struct {
+	XMLName  xml.Name `xml:"key" json:"-"`
+	ID       string   `xml:"id,attr" json:"id"`
+	Name     string   `xml:"name,attr" json:"name"`
+	Created  string   `xml:"created,attr,omitempty" json:"created,omitempty"`
+	Expires  string   `xml:"expires,attr,omitempty" json:"expires,omitempty"`
+	Disabled bool     `xml:"disabled,attr" json:"disabled"`
+	Legacy   bool     `xml:"legacy,attr" json:"legacy"` // used without its id, rotate to replace it
+	Secret   string   `xml:"secret,attr,omitempty" json:"secret,omitempty"`
+	Roles    []string `xml:"role" json:"roles"`
+	Ngis     []string `xml:"ngi" json:"ngis"`
+}
+
+type ReadRoot struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Key     []*Key   `json:"keys"`
+}
+
+type Message struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
+}
+
+// KeyInput is the json input creating a key
+type KeyInput struct {
+	Name    string   `json:"name"`
+	Roles   []string `json:"roles"`
+	Ngis    []string `json:"ngis"`
+	Expires string   `json:"expires"` // RFC 3339 timestamp, never when empty
+}
+
+const zuluForm = "2006-01-02T15:04:05Z"
+
+// validate checks the roles and expiry date of the input, returning a message
+// for the user when they are not acceptable
+func validate(input KeyInput) (time.Time, string) {
+
+	expires := time.Time{}
+
+	if len(input.Roles) == 0 {
+		return expires, "At least one role is required"
+	}
+
+	for _, role := range input.Roles {
+		known := false
+		for _, r := range authentication.Roles {
+			known = known || r == role
+		}
+		if !known {
+			return expires, "Unknown role " + role
+		}
+	}
+
+	if input.Expires != "" {
+		var err error
+		expires, err = time.Parse(time.RFC3339, input.Expires)
+		if err != nil {
+			return expires, "Malformed expiry date, use the form " + zuluForm
+		}
+	}
+
+	return expires, ""
+}
+
+func readOne(id string) bson.M {
+
+	query := bson.M{
+		"_id": bson.ObjectIdHex(id),
+	}
+
+	return query
+}
+
+func createOne(id bson.ObjectId, input KeyInput, expires time.Time, salt string, hash string) bson.M {
+
+	query := bson.M{
+		"_id":      id,
+		"name":     input.Name,
+		"roles":    input.Roles,
+		"ngis":     input.Ngis,
+		"salt":     salt,
+		"hash":     hash,
+		"created":  time.Now().UTC(),
+		"disabled": false,
+	}
+
+	if !expires.IsZero() {
+		query["expires"] = expires.UTC()
+	}
+
+	return query
+}
+
+func rotateOne(salt string, hash string) bson.M {
+
+	query := bson.M{
+		"$set":   bson.M{"salt": salt, "hash": hash},
+		"$unset": bson.M{"legacy": ""},
+	}
+
+	return query
+}
+
+func disableOne() bson.M {
+
+	query := bson.M{
+		"$set": bson.M{"disabled": true},
+	}
+
+	return query
+}
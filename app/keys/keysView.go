@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package keys
+
+import (
+	"github.com/argoeu/argo-web-api/utils/authentication"
+)
+
+func keyView(auth authentication.Auth) *Key {
+
+	key := &Key{
+		ID:       auth.Id.Hex(),
+		Name:     auth.Name,
+		Disabled: auth.Disabled,
+		Legacy:   auth.Legacy,
+		Roles:    auth.Roles,
+		Ngis:     auth.Ngis,
+	}
+
+	//Keys stored before roles were introduced keep the access they always had
+	if key.Roles == nil {
+		key.Roles = authentication.LegacyRoles
+	}
+
+	if !auth.Created.IsZero() {
+		key.Created = auth.Created.UTC().Format(zuluForm)
+	}
+
+	if !auth.Expires.IsZero() {
+		key.Expires = auth.Expires.UTC().Format(zuluForm)
+	}
+
+	return key
+}
+
+func createView(results []authentication.Auth) interface{} {
+
+	docRoot := &ReadRoot{}
+
+	for _, result := range results {
+		docRoot.Key = append(docRoot.Key, keyView(result))
+	}
+
+	return docRoot
+}
+
+// secretView renders a key along with its secret, which is shown only once
+func secretView(auth authentication.Auth, secret string) interface{} {
+
+	key := keyView(auth)
+	key.Secret = auth.Id.Hex() + "." + secret
+
+	docRoot := &ReadRoot{Key: []*Key{key}}
+
+	return docRoot
+}
+
+func messageView(answer string) interface{} {
+	docRoot := &Message{}
+	docRoot.Message = answer
+	return docRoot
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package keys
+
+import (
+	"code.google.com/p/gcfg"
+	"github.com/argoeu/argo-web-api/utils/authentication"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"github.com/argoeu/argo-web-api/utils/mongo"
+	"github.com/argoeu/argo-web-api/utils/render"
+	"github.com/stretchr/testify/suite"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type KeysTestSuite struct {
+	suite.Suite
+	cfg config.Config
+}
+
+// Setup the Test Environment
+// The testdb AR_test is seeded with a key stored before roles were
+// introduced, "S3CR3T", and an admin key, "ADM1N"
+func (suite *KeysTestSuite) SetupTest() {
+
+	const testConfig = `
+    [server]
+    bindip = ""
+    port = 8080
+    maxprocs = 4
+    cache = false
+    lrucache = 700000000
+    gzip = true
+    [mongodb]
+    host = "127.0.0.1"
+    port = 27017
+    db = "AR_test"
+`
+
+	_ = gcfg.ReadStringInto(&suite.cfg, testConfig)
+
+	session, _ := mongo.OpenSession(suite.cfg)
+	defer mongo.CloseSession(session)
+
+	_ = mongo.Insert(session, suite.cfg.MongoDB.Db, "authentication", bson.M{"apiKey": "S3CR3T"})
+	_ = mongo.Insert(session, suite.cfg.MongoDB.Db, "authentication", bson.M{"apiKey": "ADM1N", "roles": []string{"admin"}})
+
+	//The server hashes the keys inserted by hand at startup
+	_, _ = authentication.MigrateKeys(suite.cfg)
+}
+
+// Keys stored before roles were introduced could never manage keys or read
+// the audit log and must not be able to now
+func (suite *KeysTestSuite) TestLegacyKeyForbidden() {
+
+	request, _ := http.NewRequest("GET", "/api/v1/keys", strings.NewReader(""))
+	request.Header.Set("x-api-key", "S3CR3T")
+	request.Header.Set("Accept", "application/json")
+	code, _, output, _ := List(request, suite.cfg)
+	suite.Equal(403, code)
+	suite.Contains(string(body(request, output)), `"message": "Forbidden"`)
+
+	request, _ = http.NewRequest("GET", "/api/v1/keys", strings.NewReader(""))
+	request.Header.Set("x-api-key", "ADM1N")
+	code, _, _, _ = List(request, suite.cfg)
+	suite.Equal(200, code)
+}
+
+// Keys inserted with a plaintext apiKey are hashed by MigrateKeys and
+// listed as legacy keys, with the roles they always had when they store none
+func (suite *KeysTestSuite) TestLegacyKeyHashed() {
+
+	request, _ := http.NewRequest("GET", "/api/v1/keys", strings.NewReader(""))
+	request.Header.Set("x-api-key", "ADM1N")
+	request.Header.Set("Accept", "application/json")
+	code, _, output, _ := List(request, suite.cfg)
+	suite.Equal(200, code)
+	suite.Contains(string(body(request, output)), `"legacy": true`)
+	suite.Contains(string(body(request, output)), `"recomputations:write"`)
+
+	session, _ := mongo.OpenSession(suite.cfg)
+	defer mongo.CloseSession(session)
+
+	c := session.DB(suite.cfg.MongoDB.Db).C("authentication")
+	plaintext, _ := c.Find(bson.M{"apiKey": bson.M{"$exists": true}}).Count()
+	suite.Equal(0, plaintext)
+	hashed, _ := c.Find(bson.M{"legacy": true, "hash": bson.M{"$exists": true}}).Count()
+	suite.Equal(2, hashed)
+}
+
+func (suite *KeysTestSuite) TearDownTest() {
+
+	session, _ := mongo.OpenSession(suite.cfg)
+
+	session.DB("AR_test").DropDatabase()
+
+}
+
+// body renders what a handler returned the way Respond does
+func body(request *http.Request, output interface{}) []byte {
+	rendered, _ := render.Output(render.FromRequest(request), output)
+	return rendered
+}
+
+func TestKeysTestSuite(t *testing.T) {
+	suite.Run(t, new(KeysTestSuite))
+}
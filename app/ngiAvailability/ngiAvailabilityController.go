@@ -27,24 +27,25 @@
 package ngiAvailability
 
 import (
-	"fmt"
 	"github.com/argoeu/argo-web-api/utils/caches"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
+	"github.com/argoeu/argo-web-api/utils/periods"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"net/http"
 	"strings"
+	"time"
 )
 
-func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
+	contentType := render.FromRequest(r)
 
 	//STANDARD DECLARATIONS END
 
@@ -56,12 +57,23 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		urlValues.Get("end_time"),
 		urlValues.Get("availability_profile"),
 		urlValues.Get("granularity"),
+		urlValues.Get("period"),
 		urlValues.Get("infrastructure"),
 		urlValues.Get("production"),
 		urlValues.Get("monitored"),
 		urlValues.Get("certification"),
-		urlValues.Get("format"),
+		contentType,
 		urlValues["group_name"],
+		urlValues["scope"],
+		urlValues["site_scope"],
+	}
+
+	if len(input.Scope) == 0 {
+		input.Scope = cfg.Reports.Scope
+	}
+
+	if len(input.Site_scope) == 0 {
+		input.Site_scope = cfg.Reports.Sitescope
 	}
 
 	if len(input.Infrastructure) == 0 {
@@ -84,14 +96,29 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		input.Certification = "Certified"
 	}
 
-	if strings.ToLower(input.format) == "json" {
-		contentType = "application/json"
+	period := periods.Period{}
+
+	if len(input.Period) > 0 {
+		period, err = periods.Parse(input.Period)
+		if err != nil {
+			code = http.StatusBadRequest
+			output = messageView("Invalid period. Please use an ISO 8601 duration such as P7D, P1M or P3M")
+			return code, h, output, err
+		}
+	}
+
+	switch strings.ToLower(input.Granularity) {
+	case "", "daily", "weekly", "monthly", "yearly":
+	default:
+		code = http.StatusBadRequest
+		output = messageView("Unsupported granularity. Please use one of daily, weekly, monthly or yearly")
+		return code, h, output, err
 	}
 
-	found, output := caches.HitCache("ngis", input, cfg)
-	h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+	found, output, stored := caches.Lookup("ngis", input, cfg)
 
 	if found {
+		h.Set("Last-Modified", stored.UTC().Format(http.TimeFormat))
 		return code, h, output, err
 	}
 
@@ -102,39 +129,58 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		return code, h, output, err
 	}
 
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
 	results := []ApiNgiAvailabilityInProfileOutput{}
 
-	// Select the granularity of the search daily/monthly
-	if len(input.Granularity) == 0 || strings.ToLower(input.Granularity) == "daily" {
+	// Select the granularity of the search daily/weekly/monthly/yearly
+	// A custom period takes precedence over the granularity
+	if len(input.Period) > 0 {
+		start, _ := time.Parse(zuluForm, input.Start_time)
+		CustomForm[0] = "20060102"
+		CustomForm[1] = "2006-01-02"
+		query := Days(input)
+		err = repo.Pipe("sites", query, &results)
+		results = aggregate(results, periods.Anchored(start, period))
+
+	} else if len(input.Granularity) == 0 || strings.ToLower(input.Granularity) == "daily" {
 		CustomForm[0] = "20060102"
 		CustomForm[1] = "2006-01-02"
 		query := Daily(input)
-		err = mongo.Pipe(session, "AR", "sites", query, &results)
+		err = repo.Pipe("sites", query, &results)
+
+	} else if strings.ToLower(input.Granularity) == "weekly" {
+		CustomForm[0] = "20060102"
+		CustomForm[1] = "2006-01-02"
+		query := Days(input)
+		err = repo.Pipe("sites", query, &results)
+		results = aggregate(results, periods.Weekly)
 
 	} else if strings.ToLower(input.Granularity) == "monthly" {
 		CustomForm[0] = "200601"
 		CustomForm[1] = "2006-01"
 		query := Monthly(input)
-		err = mongo.Pipe(session, "AR", "sites", query, &results)
-	}
+		err = repo.Pipe("sites", query, &results)
 
-	if err != nil {
-		code = http.StatusInternalServerError
-		return code, h, output, err
+	} else if strings.ToLower(input.Granularity) == "yearly" {
+		CustomForm[0] = "2006"
+		CustomForm[1] = "2006"
+		query := Yearly(input)
+		err = repo.Pipe("sites", query, &results)
 	}
 
-	output, err = createView(results, input.format)
-
 	if err != nil {
 		code = http.StatusInternalServerError
 		return code, h, output, err
 	}
 
+	output = createView(results, input.format)
+
 	if len(results) > 0 {
-		caches.WriteCache("ngis", input, output, cfg)
+		output = caches.Pending{Name: "ngis", Input: input, Document: output}
 	}
 
-	mongo.CloseSession(session)
-
 	return code, h, output, err
 }
@@ -2,6 +2,7 @@ package ngiAvailability
 
 import (
 	"encoding/xml"
+	"github.com/argoeu/argo-web-api/utils/periods"
 	"labix.org/v2/mgo/bson"
 	"strconv"
 	"time"
@@ -17,6 +18,8 @@ type Availability struct {
 type Ngi struct {
 	XMLName      xml.Name `xml:"Ngi" json:"-"`
 	Ngi          string   `xml:"NGI,attr" json:"NGI"`
+	Scope        string   `xml:"scope,attr" json:"scope"`
+	SiteScope    string   `xml:"site_scope,attr" json:"site_scope"`
 	Availability []*Availability
 }
 
@@ -31,25 +34,35 @@ type Root struct {
 	Profile []*Profile
 }
 
+type Message struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
+}
+
 type ApiNgiAvailabilityInProfileInput struct {
 	// mandatory values
 	Start_time           string // UTC time in W3C format
 	End_time             string // UTC time in W3C format
 	Availability_profile string //availability profile
 	// optional values
-	Granularity    string   //availability period; possible values: `DAILY`, MONTHLY`
+	Granularity    string   //availability period; possible values: `DAILY`, `WEEKLY`, `MONTHLY`, `YEARLY`
+	Period         string   // custom ISO 8601 aggregation period, e.g. `P7D`, `P1M`, `P3M`; overrides granularity
 	Infrastructure string   //infrastructure name
 	Production     string   //production or not
 	Monitored      string   //yes or no
 	Certification  string   //certification status
-	format         string   // default XML; possible values are: XML, JSON
+	format         string   // negotiated media type of the response
 	Group_name     []string // site name; may appear more than once
+	Scope          []string // scope of the sites; may appear more than once
+	Site_scope     []string // site scope; may appear more than once
 }
 
 type ApiNgiAvailabilityInProfileOutput struct {
 	Date         string  `bson:"dt"`
 	Profile      string  `bson:"ap"`
 	Ngi          string  `bson:"n"`
+	Scope        string  `bson:"sc"`
+	SiteScope    string  `bson:"ss"`
 	Availability float64 `bson:"a"`
 	Reliability  float64 `bson:"r"`
 }
@@ -86,10 +99,8 @@ func prepareFilter(input ApiNgiAvailabilityInProfileInput) bson.M {
 	filter["pr"] = input.Production
 	filter["m"] = input.Monitored
 
-	//TODO: Remove hardcoded filtering and add this
-	// as a parameter
-	filter["sc"] = "EGI"
-	filter["ss"] = "EGI"
+	filter["sc"] = bson.M{"$in": input.Scope}
+	filter["ss"] = bson.M{"$in": input.Site_scope}
 
 	return filter
 }
@@ -99,29 +110,58 @@ func Daily(input ApiNgiAvailabilityInProfileInput) []bson.M {
 	// Mongo aggregation pipeline
 	// Select all the records that match q
 	// Project the results to add 1 to every hepspec(hs) to avoid having 0 as a hepspec
-	// Group them by the first 8 digits of datetime (YYYYMMDD) and each group find
+	// Group them by the first 8 digits of datetime (YYYYMMDD), ngi and scopes and for each group find
 	// a = sum(a*hs)
 	// r = sum(r*hs)
 	// hs = sum(hs)
 	// Project to a better format and do these computations
 	// a = a/hs
 	// r = r/hs
-	// Sort by profile->ngi->site->datetime
+	// Sort by profile->ngi->scope->site scope->datetime
 	query := []bson.M{
 		{"$match": filter},
-		{"$project": bson.M{"dt": 1, "a": 1, "r": 1, "ap": 1, "n": 1, "hs": bson.M{"$add": list{"$hs", 1}}}},
-		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 8}}}, "n": "$n", "ap": "$ap"},
+		{"$project": bson.M{"dt": 1, "a": 1, "r": 1, "ap": 1, "n": 1, "sc": 1, "ss": 1, "hs": bson.M{"$add": list{"$hs", 1}}}},
+		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 8}}}, "n": "$n", "sc": "$sc", "ss": "$ss", "ap": "$ap"},
 			"a": bson.M{"$sum": bson.M{"$multiply": list{"$a", "$hs"}}}, "r": bson.M{"$sum": bson.M{"$multiply": list{"$r", "$hs"}}}, "hs": bson.M{"$sum": "$hs"}}},
-		{"$project": bson.M{"dt": "$_id.dt", "n": "$_id.n", "ap": "$_id.ap", "a": bson.M{"$divide": list{"$a", "$hs"}},
+		{"$project": bson.M{"dt": "$_id.dt", "n": "$_id.n", "sc": "$_id.sc", "ss": "$_id.ss", "ap": "$_id.ap", "a": bson.M{"$divide": list{"$a", "$hs"}},
 			"r": bson.M{"$divide": list{"$r", "$hs"}}}},
-		{"$sort": bson.D{{"ap", 1}, {"n", 1}, {"s", 1}, {"dt", 1}}}}
+		{"$sort": bson.D{{"ap", 1}, {"n", 1}, {"sc", 1}, {"ss", 1}, {"dt", 1}}}}
 
 	//query := []bson.M{{"$match": q}, {"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 8}}}, "n": "$n", "ns": "$ns", "p": "$p"}, "a": bson.M{"$sum": bson.M{"$multiply": list{"$a", "$hs"}}}, 		"r": bson.M{"$sum": bson.M{"$multiply": list{"$r", "$hs"}}}, "hs": bson.M{"$sum": "$hs"}}}, {"$match": bson.M{"hs": bson.M{"$gt": 0}}}, {"$project": bson.M{"dt": "$_id.dt", "n": "$_id.n", "ns": "$_id.ns", "p": 		"$_id.p", "a": bson.M{"$divide": list{"$a", "$hs"}}, "r": bson.M{"$divide": list{"$r", "$hs"}}}}, {"$sort": bson.D{{"p", 1}, {"n", 1}, {"s", 1}, {"dt", 1}}}}
 
 	return query
 }
 
+func Days(input ApiNgiAvailabilityInProfileInput) []bson.M {
+	filter := prepareFilter(input)
+	filter["a"] = bson.M{"$gte": 0}
+	filter["r"] = bson.M{"$gte": 0}
+
+	// Mongo aggregation pipeline
+	// Compute the hepspec weighted daily availability and reliability of
+	// every ngi the same way Monthly does. The daily values are averaged
+	// per period afterwards, see aggregate
+	// Sort by profile->ngi->scope->site scope->datetime
+
+	query := []bson.M{
+		{"$match": filter}, {"$project": bson.M{"dt": 1, "a": 1, "r": 1, "ap": 1, "n": 1, "sc": 1, "ss": 1, "hs": bson.M{"$add": list{"$hs", 1}}}},
+		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 8}}}, "n": "$n", "sc": "$sc", "ss": "$ss", "ap": "$ap"}, "a": bson.M{"$sum": bson.M{"$multiply": list{"$a", "$hs"}}},
+			"r": bson.M{"$sum": bson.M{"$multiply": list{"$r", "$hs"}}}, "hs": bson.M{"$sum": "$hs"}}}, {"$match": bson.M{"hs": bson.M{"$gt": 0}}},
+		{"$project": bson.M{"dt": "$_id.dt", "n": "$_id.n", "sc": "$_id.sc", "ss": "$_id.ss", "ap": "$_id.ap", "a": bson.M{"$divide": list{"$a", "$hs"}}, "r": bson.M{"$divide": list{"$r", "$hs"}}}},
+		{"$sort": bson.D{{"ap", 1}, {"n", 1}, {"sc", 1}, {"ss", 1}, {"dt", 1}}}}
+
+	return query
+}
+
 func Monthly(input ApiNgiAvailabilityInProfileInput) []bson.M {
+	return groupByDate(input, 6)
+}
+
+func Yearly(input ApiNgiAvailabilityInProfileInput) []bson.M {
+	return groupByDate(input, 4)
+}
+
+func groupByDate(input ApiNgiAvailabilityInProfileInput, digits int) []bson.M {
 	filter := prepareFilter(input)
 	//PROBABLY THIS LEADS TO THE SAME BUG WE RAN INTO WITH SITES. MUST BE INVESTIGATED!!!!!!!!!!!!
 	filter["a"] = bson.M{"$gte": 0}
@@ -130,27 +170,56 @@ func Monthly(input ApiNgiAvailabilityInProfileInput) []bson.M {
 	// Mongo aggregation pipeline
 	// Select all the records that match q
 	// Project the results to add 1 to every hepspec(hs) to avoid having 0 as a hepspec
-	// Group them by the first 8 digits of datetime (YYYYMMDD) and each group find
+	// Group them by the first 8 digits of datetime (YYYYMMDD), ngi and scopes and for each group find
 	// a = sum(a*hs)
 	// r = sum(r*hs)
 	// hs = sum(hs)
 	// Project to a better format and do these computations
 	// a = a/hs
 	// r = r/hs
-	// Group by the first 6 digits of the datetime (YYYYMM) and by ngi,site,profile and for each group find
+	// Group by the first digits of the datetime (YYYYMM or YYYY) and by ngi,scopes,profile and for each group find
 	// a = average(a)
 	// r = average(r)
 	// Project the results to a better format
-	// Sort by namespace->profile->ngi->datetime
+	// Sort by namespace->profile->ngi->scope->site scope->datetime
 
 	query := []bson.M{
-		{"$match": filter}, {"$project": bson.M{"dt": 1, "a": 1, "r": 1, "ap": 1, "n": 1, "hs": bson.M{"$add": list{"$hs", 1}}}},
-		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 8}}}, "n": "$n", "ap": "$ap"}, "a": bson.M{"$sum": bson.M{"$multiply": list{"$a", "$hs"}}},
+		{"$match": filter}, {"$project": bson.M{"dt": 1, "a": 1, "r": 1, "ap": 1, "n": 1, "sc": 1, "ss": 1, "hs": bson.M{"$add": list{"$hs", 1}}}},
+		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 8}}}, "n": "$n", "sc": "$sc", "ss": "$ss", "ap": "$ap"}, "a": bson.M{"$sum": bson.M{"$multiply": list{"$a", "$hs"}}},
 			"r": bson.M{"$sum": bson.M{"$multiply": list{"$r", "$hs"}}}, "hs": bson.M{"$sum": "$hs"}}}, {"$match": bson.M{"hs": bson.M{"$gt": 0}}},
-		{"$project": bson.M{"dt": "$_id.dt", "n": "$_id.n", "ap": "$_id.ap", "a": bson.M{"$divide": list{"$a", "$hs"}}, "r": bson.M{"$divide": list{"$r", "$hs"}}}},
-		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 6}}}, "n": "$n", "ap": "$ap"}, "a": bson.M{"$avg": "$a"},
-			"r": bson.M{"$avg": "$r"}}}, {"$project": bson.M{"dt": "$_id.dt", "n": "$_id.n", "ap": "$_id.ap", "a": 1, "r": 1}},
-		{"$sort": bson.D{{"ap", 1}, {"n", 1}, {"dt", 1}}}}
+		{"$project": bson.M{"dt": "$_id.dt", "n": "$_id.n", "sc": "$_id.sc", "ss": "$_id.ss", "ap": "$_id.ap", "a": bson.M{"$divide": list{"$a", "$hs"}}, "r": bson.M{"$divide": list{"$r", "$hs"}}}},
+		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, digits}}}, "n": "$n", "sc": "$sc", "ss": "$ss", "ap": "$ap"}, "a": bson.M{"$avg": "$a"},
+			"r": bson.M{"$avg": "$r"}}}, {"$project": bson.M{"dt": "$_id.dt", "n": "$_id.n", "sc": "$_id.sc", "ss": "$_id.ss", "ap": "$_id.ap", "a": 1, "r": 1}},
+		{"$sort": bson.D{{"ap", 1}, {"n", 1}, {"sc", 1}, {"ss", 1}, {"dt", 1}}}}
 
 	return query
 }
+
+// aggregate averages the daily availability and reliability of each ngi and
+// scope over the period that bucket assigns every day to. The results must
+// be sorted by ngi, scope and date.
+func aggregate(results []ApiNgiAvailabilityInProfileOutput, bucket periods.Bucketer) []ApiNgiAvailabilityInProfileOutput {
+
+	dated := []ApiNgiAvailabilityInProfileOutput{}
+	rows := []periods.Row{}
+
+	for _, row := range results {
+		day, err := time.Parse(ymdForm, row.Date)
+		if err != nil {
+			continue
+		}
+		dated = append(dated, row)
+		rows = append(rows, periods.Row{Key: [4]string{row.Profile, row.Ngi, row.Scope, row.SiteScope}, Day: day, Values: []float64{row.Availability, row.Reliability}})
+	}
+
+	aggregated := []ApiNgiAvailabilityInProfileOutput{}
+
+	for _, average := range periods.Aggregate(rows, bucket) {
+		row := dated[average.First]
+		row.Date = average.Start.Format(ymdForm)
+		row.Availability, row.Reliability = average.Values[0], average.Values[1]
+		aggregated = append(aggregated, row)
+	}
+
+	return aggregated
+}
@@ -27,14 +27,18 @@
 package ngiAvailability
 
 import (
-	"encoding/json"
-	"encoding/xml"
+	"bytes"
+	"encoding/csv"
 	"fmt"
-	"strings"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"time"
 )
 
-func createView(results []ApiNgiAvailabilityInProfileOutput, format string) ([]byte, error) {
+func createView(results []ApiNgiAvailabilityInProfileOutput, contentType string) interface{} {
+
+	if contentType == render.CSV {
+		return csvReport{results, CustomForm[0], CustomForm[1]}
+	}
 
 	docRoot := &Root{}
 
@@ -56,12 +60,14 @@ func createView(results []ApiNgiAvailabilityInProfileOutput, format string) ([]b
 			docRoot.Profile = append(docRoot.Profile, profile)
 			prevNgi = ""
 		}
-		//if new ngi does not match the previous ngi value
+		//if new ngi or its scopes do not match the previous ones
 		//we create a new ngi entry in the xml
-		if prevNgi != row.Ngi {
+		if prevNgi != row.Ngi || ngi.Scope != row.Scope || ngi.SiteScope != row.SiteScope {
 			prevNgi = row.Ngi
 			ngi = &Ngi{
-				Ngi: row.Ngi,
+				Ngi:       row.Ngi,
+				Scope:     row.Scope,
+				SiteScope: row.SiteScope,
 			}
 			profile.Ngi = append(profile.Ngi, ngi)
 		}
@@ -73,9 +79,40 @@ func createView(results []ApiNgiAvailabilityInProfileOutput, format string) ([]b
 				Reliability:  fmt.Sprintf("%g", row.Reliability)})
 	}
 
-	if strings.ToLower(format) == "json" {
-		return json.MarshalIndent(docRoot, " ", "  ")
-	} else {
-		return xml.MarshalIndent(docRoot, " ", "  ")
+	return docRoot
+}
+
+func messageView(answer string) interface{} {
+	docRoot := &Message{}
+	docRoot.Message = answer
+	return docRoot
+}
+
+// csvReport writes one row per profile, ngi, scope and timestamp straight from the
+// query results without building the document tree first, so that reports
+// spanning long periods are rendered with little memory overhead.
+type csvReport struct {
+	results []ApiNgiAvailabilityInProfileOutput
+	dbForm  string
+	form    string
+}
+
+// MarshalCSV writes the report, see render.CSVMarshaler
+func (report csvReport) MarshalCSV() ([]byte, error) {
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	w.Write([]string{"profile", "ngi", "scope", "site_scope", "timestamp", "availability", "reliability"})
+
+	for _, row := range report.results {
+		timestamp, _ := time.Parse(report.dbForm, row.Date)
+		w.Write([]string{row.Profile, row.Ngi, row.Scope, row.SiteScope,
+			timestamp.Format(report.form),
+			fmt.Sprintf("%g", row.Availability),
+			fmt.Sprintf("%g", row.Reliability)})
 	}
+
+	w.Flush()
+	return b.Bytes(), w.Error()
 }
@@ -27,22 +27,19 @@
 package poemProfiles
 
 import (
-	"fmt"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
 	"net/http"
 )
 
-func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
 
 	//STANDARD DECLARATIONS END
 
@@ -53,22 +50,19 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		return code, h, output, err
 	}
 
-	results := []PoemProfilesOutput{}
-	err = mongo.Find(session, "AR", "poem_list", nil, "p", &results)
+	defer mongo.CloseSession(session)
 
-	if err != nil {
-		code = http.StatusInternalServerError
-		return code, h, output, err
-	}
+	repo := mongo.NewRepository(session, cfg)
 
-	output, err = createView(results) //Render the results into XML format
+	results := []PoemProfilesOutput{}
+	err = repo.Find("poem_list", nil, "p", &results)
 
 	if err != nil {
 		code = http.StatusInternalServerError
 		return code, h, output, err
 	}
 
-	mongo.CloseSession(session)
-	h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+	output = createView(results) //Respond renders the results into the negotiated format
+
 	return code, h, output, err
 }
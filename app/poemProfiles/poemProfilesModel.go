@@ -27,11 +27,11 @@
 package poemProfiles
 
 type Poem struct {
-	Poem string `xml:"profile,attr"`
+	Poem string `xml:"profile,attr" json:"profile"`
 }
 
 type root struct {
-	Poem []*Poem
+	Poem []*Poem `json:"poems"`
 }
 
 type PoemProfilesOutput struct {
@@ -26,11 +26,7 @@
 
 package poemProfiles
 
-import (
-	"encoding/xml"
-)
-
-func createView(results []PoemProfilesOutput) ([]byte, error) {
+func createView(results []PoemProfilesOutput) interface{} {
 
 	docRoot := &root{}
 
@@ -40,7 +36,6 @@ func createView(results []PoemProfilesOutput) ([]byte, error) {
 		docRoot.Poem = append(docRoot.Poem, p)
 	}
 
-	output, err := xml.MarshalIndent(docRoot, "", " ")
-	return output, err
+	return docRoot
 
 }
@@ -27,24 +27,22 @@
 package recomputations
 
 import (
-	"fmt"
 	"github.com/argoeu/argo-web-api/utils/authentication"
+	"github.com/argoeu/argo-web-api/utils/caches"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
 	"net/http"
 	"time"
 )
 
-func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
 
 	//STANDARD DECLARATIONS END
 
@@ -55,43 +53,40 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		return code, h, output, err
 	}
 
-	results := []RecomputationsInputOutput{}
-	err = mongo.Find(session, "AR", "recalculations", nil, "t", &results)
+	defer mongo.CloseSession(session)
 
-	if err != nil {
-		code = http.StatusInternalServerError
-		return code, h, output, err
-	}
+	repo := mongo.NewRepository(session, cfg)
 
-	output, err = createView(results)
+	results := []RecomputationsInputOutput{}
+	err = repo.Find("recalculations", nil, "t", &results)
 
 	if err != nil {
 		code = http.StatusInternalServerError
 		return code, h, output, err
 	}
 
-	mongo.CloseSession(session)
-	h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+	output = createView(results)
+
 	return code, h, output, err
 }
 
-func Create(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func Create(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
 
 	//STANDARD DECLARATIONS END
 
 	message := ""
 
-	//only authenticated requests triger the handling code
-	if authentication.Authenticate(r.Header, cfg) {
+	//only requests authorized to file recomputations triger the handling code
+	identity, code := authentication.Authorize(r, cfg, authentication.RecomputationsWrite)
+
+	if code == http.StatusOK {
 
 		session, err := mongo.OpenSession(cfg)
 
@@ -100,6 +95,10 @@ func Create(r *http.Request, cfg config.Config) (int, http.Header, []byte, error
 			return code, h, output, err
 		}
 
+		defer mongo.CloseSession(session)
+
+		repo := mongo.NewRepository(session, cfg)
+
 		err = r.ParseForm()
 
 		if err != nil {
@@ -122,30 +121,33 @@ func Create(r *http.Request, cfg config.Config) (int, http.Header, []byte, error
 			//urlValues["exclude_end_point"],
 		}
 
-		query := insertQuery(input)
-		err = mongo.Insert(session, "AR", "recalculations", query)
+		//Keys may be restricted to the NGIs they file recomputations for
+		if !identity.AllowsNgi(input.NgiName) {
+			message = "Not allowed to file recomputations for " + input.NgiName
+			output = messageView(message)
 
-		if err != nil {
-			code = http.StatusInternalServerError
+			code = http.StatusForbidden
 			return code, h, output, err
 		}
 
-		mongo.CloseSession(session)
-		message = "A recalculation request has been filed"
-		output, err := messageXML(message) //Render the response into XML
+		query := insertQuery(input)
+		err = repo.Insert("recalculations", query)
 
 		if err != nil {
 			code = http.StatusInternalServerError
 			return code, h, output, err
 		}
 
-		h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+		//Cached availability reports may no longer be valid
+		caches.Purge(cfg, caches.Availability...)
+
+		message = "A recalculation request has been filed"
+		output = messageView(message) //Respond renders the response into the negotiated format
+
 		return code, h, output, err
 
 	} else {
-		output = []byte(http.StatusText(http.StatusUnauthorized))
-		code = http.StatusUnauthorized //If wrong api key is passed we return UNAUTHORIZED http status
-		h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+		output = messageView(http.StatusText(code)) //If the api key is wrong or lacks the role we return UNAUTHORIZED or FORBIDDEN http status
 		return code, h, output, err
 	}
 }
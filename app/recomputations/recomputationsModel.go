@@ -49,24 +49,24 @@ type Exclude struct {
 }
 
 type Request struct {
-	XMLName   xml.Name `xml:"Request" json:"-"`
-	StartTime string   `xml:"start_time,attr" json:"start_time"`
-	EndTime   string   `xml:"end_time,attr" json:"end_time"`
-	Reason    string   `xml:"reason,attr" json:"reason"`
-	NgiName   string   `xml:"ngi_name,attr" json:"ngi_name"`
-	Status    string   `xml:"status,attr" json:"status"`
-	Timestamp string   `xml:"timestamp,attr" json:"timestamp"`
-	Exclude   []*Exclude
+	XMLName   xml.Name   `xml:"Request" json:"-"`
+	StartTime string     `xml:"start_time,attr" json:"start_time"`
+	EndTime   string     `xml:"end_time,attr" json:"end_time"`
+	Reason    string     `xml:"reason,attr" json:"reason"`
+	NgiName   string     `xml:"ngi_name,attr" json:"ngi_name"`
+	Status    string     `xml:"status,attr" json:"status"`
+	Timestamp string     `xml:"timestamp,attr" json:"timestamp"`
+	Exclude   []*Exclude `json:"exclude"`
 }
 
 type Root struct {
-	XMLName xml.Name `xml:"root" json:"-"`
-	Request []*Request
+	XMLName xml.Name   `xml:"root" json:"-"`
+	Request []*Request `json:"requests"`
 }
 
 type Message struct {
-	XMLName xml.Name `xml:"root"`
-	Message string
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
 }
 
 func insertQuery(input RecomputationsInputOutput) bson.M {
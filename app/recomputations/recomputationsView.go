@@ -26,12 +26,7 @@
 
 package recomputations
 
-import (
-	//"encoding/json"
-	"encoding/xml"
-)
-
-func createView(results []RecomputationsInputOutput) ([]byte, error) {
+func createView(results []RecomputationsInputOutput) interface{} {
 
 	docRoot := &Root{}
 
@@ -51,13 +46,11 @@ func createView(results []RecomputationsInputOutput) ([]byte, error) {
 		}
 		docRoot.Request = append(docRoot.Request, r)
 	}
-	output, err := xml.MarshalIndent(docRoot, "", " ")
-	return output, err
+	return docRoot
 }
 
-func messageXML(answer string) ([]byte, error) {
+func messageView(answer string) interface{} {
 	docRoot := &Message{}
 	docRoot.Message = answer
-	output, err := xml.MarshalIndent(docRoot, " ", "  ")
-	return output, err
+	return docRoot
 }
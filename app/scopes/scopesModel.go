@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package scopes
+
+import (
+	"encoding/xml"
+	"labix.org/v2/mgo/bson"
+)
+
+type Scope struct {
+	XMLName   xml.Name `xml:"Scope" json:"-"`
+	Scope     string   `xml:"scope,attr" json:"scope"`
+	SiteScope string   `xml:"site_scope,attr" json:"site_scope"`
+	Default   bool     `xml:"default,attr" json:"default"`
+}
+
+type root struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Scope   []*Scope `json:"scopes"`
+}
+
+type ScopesOutput struct {
+	Scope     string `bson:"sc"`
+	SiteScope string `bson:"ss"`
+}
+
+// Distinct returns the pipeline that lists every scope and site scope
+// combination found in the site reports
+func Distinct() []bson.M {
+	query := []bson.M{
+		{"$group": bson.M{"_id": bson.M{"sc": "$sc", "ss": "$ss"}}},
+		{"$project": bson.M{"sc": "$_id.sc", "ss": "$_id.ss"}},
+		{"$sort": bson.D{{"sc", 1}, {"ss", 1}}}}
+
+	return query
+}
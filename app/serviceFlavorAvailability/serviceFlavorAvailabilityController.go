@@ -27,24 +27,25 @@
 package serviceFlavorAvailability
 
 import (
-	"fmt"
 	"github.com/argoeu/argo-web-api/utils/caches"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
+	"github.com/argoeu/argo-web-api/utils/periods"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"net/http"
 	"strings"
+	"time"
 )
 
-func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
+	contentType := render.FromRequest(r)
 
 	//STANDARD DECLARATIONS END
 
@@ -56,19 +57,35 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		urlValues.Get("end_time"),
 		urlValues.Get("profile"),
 		urlValues.Get("granularity"),
-		urlValues.Get("format"),
+		urlValues.Get("period"),
+		contentType,
 		urlValues["flavor"],
 		urlValues["site"],
 	}
 
-	if strings.ToLower(input.format) == "json" {
-		contentType = "application/json"
+	period := periods.Period{}
+
+	if len(input.period) > 0 {
+		period, err = periods.Parse(input.period)
+		if err != nil {
+			code = http.StatusBadRequest
+			output = messageView("Invalid period. Please use an ISO 8601 duration such as P7D, P1M or P3M")
+			return code, h, output, err
+		}
 	}
 
-	h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
-	found, output := caches.HitCache("sf", input, cfg)
+	switch strings.ToLower(input.granularity) {
+	case "", "daily", "weekly", "monthly", "yearly":
+	default:
+		code = http.StatusBadRequest
+		output = messageView("Unsupported granularity. Please use one of daily, weekly, monthly or yearly")
+		return code, h, output, err
+	}
+
+	found, output, stored := caches.Lookup("sf", input, cfg)
 
 	if found {
+		h.Set("Last-Modified", stored.UTC().Format(http.TimeFormat))
 		return code, h, output, err
 	}
 
@@ -79,38 +96,57 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		return code, h, output, err
 	}
 
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
 	results := []ApiSFAvailabilityInProfileOutput{}
 
-	if len(input.granularity) == 0 || strings.ToLower(input.granularity) == "daily" {
+	// A custom period takes precedence over the granularity
+	if len(input.period) > 0 {
+		start, _ := time.Parse(zuluForm, input.start_time)
+		customForm[0] = "20060102"
+		customForm[1] = "2006-01-02"
+		query := Days(input)
+		err = repo.Pipe("sfreports", query, &results)
+		results = aggregate(results, periods.Anchored(start, period))
+
+	} else if len(input.granularity) == 0 || strings.ToLower(input.granularity) == "daily" {
 		customForm[0] = "20060102"
 		customForm[1] = "2006-01-02"
 		query := Daily(input)
-		err = mongo.Pipe(session, "AR", "sfreports", query, &results)
+		err = repo.Pipe("sfreports", query, &results)
+
+	} else if strings.ToLower(input.granularity) == "weekly" {
+		customForm[0] = "20060102"
+		customForm[1] = "2006-01-02"
+		query := Days(input)
+		err = repo.Pipe("sfreports", query, &results)
+		results = aggregate(results, periods.Weekly)
 
 	} else if strings.ToLower(input.granularity) == "monthly" {
 		customForm[0] = "200601"
 		customForm[1] = "2006-01"
 		query := Monthly(input)
-		err = mongo.Pipe(session, "AR", "sfreports", query, &results)
-	}
+		err = repo.Pipe("sfreports", query, &results)
 
-	if err != nil {
-		code = http.StatusInternalServerError
-		return code, h, output, err
+	} else if strings.ToLower(input.granularity) == "yearly" {
+		customForm[0] = "2006"
+		customForm[1] = "2006"
+		query := Yearly(input)
+		err = repo.Pipe("sfreports", query, &results)
 	}
 
-	output, err = createView(results, input.format)
-
 	if err != nil {
 		code = http.StatusInternalServerError
 		return code, h, output, err
 	}
 
+	output = createView(results, input.format)
+
 	if len(results) > 0 {
-		caches.WriteCache("sf", input, output, cfg)
+		output = caches.Pending{Name: "sf", Input: input, Document: output}
 	}
 
-	mongo.CloseSession(session)
-
 	return code, h, output, err
 }
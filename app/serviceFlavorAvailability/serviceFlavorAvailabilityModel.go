@@ -28,6 +28,7 @@ package serviceFlavorAvailability
 
 import (
 	"encoding/xml"
+	"github.com/argoeu/argo-web-api/utils/periods"
 	"labix.org/v2/mgo/bson"
 	"strconv"
 	"time"
@@ -37,7 +38,7 @@ import (
 // help us form the xml response
 type Availability struct {
 	XMLName      xml.Name `xml:"Availability" json:"-"`
-	Timestamp    string   `xml:"timestamp,attr", json:"timestamp"`
+	Timestamp    string   `xml:"timestamp,attr" json:"timestamp"`
 	Availability string   `xml:"availability,attr" json:"availability"`
 	Reliability  string   `xml:"reliability,attr" json:"reliability"`
 }
@@ -65,12 +66,18 @@ type Root struct {
 	Profile []*Profile
 }
 
+type Message struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
+}
+
 type ApiSFAvailabilityInProfileInput struct {
 	// mandatory values
 	start_time  string // UTC time in W3C format
 	end_time    string // UTC time in W3C format
 	profile     string
-	granularity string // availability period; possible values: `HOURLY`, `DAILY`, `WEEKLY`, `MONTHLY`
+	granularity string // availability period; possible values: `DAILY`, `WEEKLY`, `MONTHLY`, `YEARLY`
+	period      string // custom ISO 8601 aggregation period, e.g. `P7D`, `P1M`, `P3M`; overrides granularity
 	format      string
 	flavor      []string // sf name; may appear more than once
 	site        []string // egi site
@@ -83,6 +90,9 @@ type ApiSFAvailabilityInProfileOutput struct {
 	Profile      string  `bson:"p"`
 	Availability float64 `bson:"a"`
 	Reliability  float64 `bson:"r"`
+	Up           float64 `bson:"up"`
+	Unknown      float64 `bson:"u"`
+	Down         float64 `bson:"d"`
 }
 
 type list []interface{}
@@ -132,16 +142,68 @@ func Daily(input ApiSFAvailabilityInProfileInput) []bson.M {
 	return query
 }
 
+func Days(input ApiSFAvailabilityInProfileInput) []bson.M {
+
+	filter := prepareFilter(input)
+
+	query := []bson.M{
+		{"$match": filter},
+		{"$project": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 8}}}, "sf": 1, "s": 1, "p": 1, "up": 1, "u": 1, "d": 1}},
+		{"$sort": bson.D{{"s", 1}, {"sf", 1}, {"dt", 1}}}}
+
+	return query
+}
+
 func Monthly(input ApiSFAvailabilityInProfileInput) []bson.M {
+	return groupByDate(input, 6)
+}
+
+func Yearly(input ApiSFAvailabilityInProfileInput) []bson.M {
+	return groupByDate(input, 4)
+}
+
+func groupByDate(input ApiSFAvailabilityInProfileInput, digits int) []bson.M {
 
 	filter := prepareFilter(input)
 
 	query := []bson.M{
 		{"$match": filter},
-		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 6}}}, "s": "$s", "p": "$p", "sf": "$sf"}, "avgup": bson.M{"$avg": "$up"}, "avgu": bson.M{"$avg": "$u"}, "avgd": bson.M{"$avg": "$d"}}},
+		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, digits}}}, "s": "$s", "p": "$p", "sf": "$sf"}, "avgup": bson.M{"$avg": "$up"}, "avgu": bson.M{"$avg": "$u"}, "avgd": bson.M{"$avg": "$d"}}},
 		{"$project": bson.M{"dt": "$_id.dt", "sf": "$_id.sf", "s": "$_id.s", "p": "$_id.p", "a": bson.M{"$multiply": list{bson.M{"$divide": list{"$avgup", bson.M{"$subtract": list{1.00000001, "$avgu"}}}}, 100}},
 			"r": bson.M{"$multiply": list{bson.M{"$divide": list{"$avgup", bson.M{"$subtract": list{bson.M{"$subtract": list{1.00000001, "$avgu"}}, "$avgd"}}}}, 100}}}},
 		{"$sort": bson.D{{"s", 1}, {"sf", 1}, {"dt", 1}}}}
 
 	return query
 }
+
+// aggregate averages the daily uptime, unknown and downtime fractions of each
+// service flavor over the period that bucket assigns every day to and computes
+// the availability and reliability of the period the same way Monthly does.
+// The results must be sorted by site, service flavor and date.
+func aggregate(results []ApiSFAvailabilityInProfileOutput, bucket periods.Bucketer) []ApiSFAvailabilityInProfileOutput {
+
+	dated := []ApiSFAvailabilityInProfileOutput{}
+	rows := []periods.Row{}
+
+	for _, row := range results {
+		day, err := time.Parse(ymdForm, row.Date)
+		if err != nil {
+			continue
+		}
+		dated = append(dated, row)
+		rows = append(rows, periods.Row{Key: [3]string{row.Profile, row.Site, row.SF}, Day: day, Values: []float64{row.Up, row.Unknown, row.Down}})
+	}
+
+	aggregated := []ApiSFAvailabilityInProfileOutput{}
+
+	for _, average := range periods.Aggregate(rows, bucket) {
+		row := dated[average.First]
+		row.Date = average.Start.Format(ymdForm)
+		row.Up, row.Unknown, row.Down = average.Values[0], average.Values[1], average.Values[2]
+		row.Availability = periods.Availability(row.Up, row.Unknown, row.Down)
+		row.Reliability = periods.Reliability(row.Up, row.Unknown, row.Down)
+		aggregated = append(aggregated, row)
+	}
+
+	return aggregated
+}
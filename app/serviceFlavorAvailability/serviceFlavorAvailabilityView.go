@@ -27,14 +27,18 @@
 package serviceFlavorAvailability
 
 import (
-	"encoding/json"
-	"encoding/xml"
+	"bytes"
+	"encoding/csv"
 	"fmt"
-	"strings"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"time"
 )
 
-func createView(results []ApiSFAvailabilityInProfileOutput, format string) ([]byte, error) {
+func createView(results []ApiSFAvailabilityInProfileOutput, contentType string) interface{} {
+
+	if contentType == render.CSV {
+		return csvReport{results, customForm[0], customForm[1]}
+	}
 
 	docRoot := &Root{}
 
@@ -80,9 +84,40 @@ func createView(results []ApiSFAvailabilityInProfileOutput, format string) ([]by
 				Availability: fmt.Sprintf("%g", row.Availability),
 				Reliability:  fmt.Sprintf("%g", row.Reliability)})
 	}
-	if strings.ToLower(format) == "json" {
-		return json.MarshalIndent(docRoot, " ", "  ")
-	} else {
-		return xml.MarshalIndent(docRoot, " ", "  ")
+	return docRoot
+}
+
+func messageView(answer string) interface{} {
+	docRoot := &Message{}
+	docRoot.Message = answer
+	return docRoot
+}
+
+// csvReport writes one row per profile, service flavor and timestamp straight from the
+// query results without building the document tree first, so that reports
+// spanning long periods are rendered with little memory overhead.
+type csvReport struct {
+	results []ApiSFAvailabilityInProfileOutput
+	dbForm  string
+	form    string
+}
+
+// MarshalCSV writes the report, see render.CSVMarshaler
+func (report csvReport) MarshalCSV() ([]byte, error) {
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	w.Write([]string{"profile", "site", "flavor", "timestamp", "availability", "reliability"})
+
+	for _, row := range report.results {
+		timestamp, _ := time.Parse(report.dbForm, row.Date)
+		w.Write([]string{row.Profile, row.Site, row.SF,
+			timestamp.Format(report.form),
+			fmt.Sprintf("%g", row.Availability),
+			fmt.Sprintf("%g", row.Reliability)})
 	}
+
+	w.Flush()
+	return b.Bytes(), w.Error()
 }
@@ -28,6 +28,7 @@ package siteAvailability
 
 import (
 	"encoding/xml"
+	"github.com/argoeu/argo-web-api/utils/periods"
 	"labix.org/v2/mgo/bson"
 	"strconv"
 	"time"
@@ -43,7 +44,7 @@ type Availability struct {
 type Site struct {
 	XMLName       xml.Name `xml:"Site" json:"-"`
 	Site          string   `xml:"site,attr" json:"site"`
-	Ngi           string   `xml:"NGI,attr"	 json:"NGI"`
+	Ngi           string   `xml:"NGI,attr" json:"NGI"`
 	Infastructure string   `xml:"infastructure,attr" json:"infrastructure"`
 	Scope         string   `xml:"scope,attr" json:"scope"`
 	SiteScope     string   `xml:"site_scope,attr" json:"site_scope"`
@@ -64,19 +65,27 @@ type Root struct {
 	Profile []*Profile
 }
 
+type Message struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
+}
+
 type SiteAvailabilityInput struct {
 	// mandatory values
 	start_time           string // UTC time in W3C format
 	end_time             string // UTC time in W3C format
 	availability_profile string //availability profile
 	// optional values
-	granularity    string   //availability period; possible values: `DAILY`, MONTHLY`
+	granularity    string   //availability period; possible values: `DAILY`, `WEEKLY`, `MONTHLY`, `YEARLY`
+	period         string   // custom ISO 8601 aggregation period, e.g. `P7D`, `P1M`, `P3M`; overrides granularity
 	infrastructure string   //infrastructure name
 	production     string   //production or not
 	monitored      string   //yes or no
 	certification  string   //certification status
-	format         string   // default XML; possible values are: XML, JSON
+	format         string   // negotiated media type of the response
 	group_name     []string // site name; may appear more than once
+	scope          []string // scope of the sites; may appear more than once
+	site_scope     []string // site scope; may appear more than once
 }
 
 type SiteAvailabilityOutput struct {
@@ -93,6 +102,9 @@ type SiteAvailabilityOutput struct {
 	CertStatus    string  `bson:"cs"`
 	Availability  float64 `bson:"a"`
 	Reliability   float64 `bson:"r"`
+	Up            float64 `bson:"up"`
+	Unknown       float64 `bson:"u"`
+	Down          float64 `bson:"d"`
 }
 
 type list []interface{}
@@ -127,10 +139,8 @@ func prepareFilter(input SiteAvailabilityInput) bson.M {
 	filter["pr"] = input.production
 	filter["m"] = input.monitored
 
-	//TODO: Remove hardcoded filtering and add this
-	// as a parameter
-	filter["sc"] = "EGI"
-	filter["ss"] = "EGI"
+	filter["sc"] = bson.M{"$in": input.scope}
+	filter["ss"] = bson.M{"$in": input.site_scope}
 
 	return filter
 }
@@ -141,36 +151,92 @@ func Daily(input SiteAvailabilityInput) []bson.M {
 	// Mongo aggregation pipeline
 	// Select all the records that match q
 	// Project to select just the first 8 digits of the date YYYYMMDD
-	// Sort by profile->ngi->site->datetime
+	// Sort by profile->ngi->site->scope->site scope->datetime
 	query := []bson.M{
 		{"$match": filter},
 		{"$project": bson.M{"dt": bson.M{"$substr": list{"$dt", 0, 8}}, "i": 1, "sc": 1, "ss": 1, "n": 1, "pr": 1, "m": 1, "cs": 1, "ns": 1, "s": 1, "ap": 1, "a": 1, "r": 1}},
-		{"$sort": bson.D{{"ap", 1}, {"n", 1}, {"s", 1}, {"dt", 1}}}}
+		{"$sort": bson.D{{"ap", 1}, {"n", 1}, {"s", 1}, {"sc", 1}, {"ss", 1}, {"dt", 1}}}}
+
+	return query
+}
+
+func Days(input SiteAvailabilityInput) []bson.M {
+	filter := prepareFilter(input)
+
+	// Mongo aggregation pipeline
+	// Select all the records that match q
+	// Project the daily uptime, unknown and downtime fractions so that they
+	// can be averaged per period, see aggregate
+	// Sort by namespace->profile->ngi->site->scope->site scope->datetime
+	query := []bson.M{
+		{"$match": filter},
+		{"$project": bson.M{"dt": bson.M{"$substr": list{"$dt", 0, 8}}, "i": 1, "sc": 1, "ss": 1, "n": 1, "pr": 1, "m": 1, "cs": 1, "ns": 1, "s": 1, "ap": 1, "up": 1, "u": 1, "d": 1}},
+		{"$sort": bson.D{{"ns", 1}, {"ap", 1}, {"n", 1}, {"s", 1}, {"sc", 1}, {"ss", 1}, {"dt", 1}}}}
 
 	return query
 }
 
 func Monthly(input SiteAvailabilityInput) []bson.M {
+	return groupByDate(input, 6)
+}
+
+func Yearly(input SiteAvailabilityInput) []bson.M {
+	return groupByDate(input, 4)
+}
+
+func groupByDate(input SiteAvailabilityInput, digits int) []bson.M {
 
 	filter := prepareFilter(input)
 
 	// Mongo aggregation pipeline
 	// Select all the records that match q
-	// Group them by the first six digits of their date (YYYYMM), their ngi, their site, their profile, etc...
+	// Group them by the first digits of their date (YYYYMM or YYYY), their ngi, their site, their scopes, their profile, etc...
 	// from that group find the average of the uptime, u, downtime
 	// Project the result to a better format and do this computation
 	// availability = (avgup/(1.00000001 - avgu))*100
 	// reliability = (avgup/((1.00000001 - avgu)-avgd))*100
-	// Sort the results by namespace->profile->ngi->site->datetime
+	// Sort the results by namespace->profile->ngi->site->scope->site scope->datetime
 
 	query := []bson.M{
 		{"$match": filter},
-		{"$group": bson.M{"_id": bson.M{"dt": bson.M{"$substr": list{"$dt", 0, 6}}, "i": "$i", "n": "$n", "pr": "$pr", "m": "$m", "cs": "$cs", "ns": "$ns", "s": "$s", "ap": "$ap"},
+		{"$group": bson.M{"_id": bson.M{"dt": bson.M{"$substr": list{"$dt", 0, digits}}, "i": "$i", "n": "$n", "pr": "$pr", "m": "$m", "cs": "$cs", "ns": "$ns", "s": "$s", "sc": "$sc", "ss": "$ss", "ap": "$ap"},
 			"avgup": bson.M{"$avg": "$up"}, "avgu": bson.M{"$avg": "$u"}, "avgd": bson.M{"$avg": "$d"}}},
-		{"$project": bson.M{"dt": "$_id.dt", "i": "$_id.i", "n": "$_id.n", "pr": "$_id.pr", "m": "$_id.m", "cs": "$_id.cs", "ns": "$_id.ns", "s": "$_id.s", "ap": "$_id.ap", "avgup": 1, "avgu": 1, "avgd": 1,
+		{"$project": bson.M{"dt": "$_id.dt", "i": "$_id.i", "n": "$_id.n", "pr": "$_id.pr", "m": "$_id.m", "cs": "$_id.cs", "ns": "$_id.ns", "s": "$_id.s", "sc": "$_id.sc", "ss": "$_id.ss", "ap": "$_id.ap", "avgup": 1, "avgu": 1, "avgd": 1,
 			"a": bson.M{"$multiply": list{bson.M{"$divide": list{"$avgup", bson.M{"$subtract": list{1.00000001, "$avgu"}}}}, 100}},
 			"r": bson.M{"$multiply": list{bson.M{"$divide": list{"$avgup", bson.M{"$subtract": list{bson.M{"$subtract": list{1.00000001, "$avgu"}}, "$avgd"}}}}, 100}}}},
-		{"$sort": bson.D{{"ns", 1}, {"ap", 1}, {"n", 1}, {"s", 1}, {"dt", 1}}}}
+		{"$sort": bson.D{{"ns", 1}, {"ap", 1}, {"n", 1}, {"s", 1}, {"sc", 1}, {"ss", 1}, {"dt", 1}}}}
 
 	return query
 }
+
+// aggregate averages the daily uptime, unknown and downtime fractions of each
+// site and scope over the period that bucket assigns every day to and
+// computes the availability and reliability of the period the same way
+// Monthly does. The results must be sorted by site, scope and date.
+func aggregate(results []SiteAvailabilityOutput, bucket periods.Bucketer) []SiteAvailabilityOutput {
+
+	dated := []SiteAvailabilityOutput{}
+	rows := []periods.Row{}
+
+	for _, row := range results {
+		day, err := time.Parse(ymdForm, row.Date)
+		if err != nil {
+			continue
+		}
+		dated = append(dated, row)
+		rows = append(rows, periods.Row{Key: [5]string{row.Namespace, row.Profile, row.Site, row.Scope, row.SiteScope}, Day: day, Values: []float64{row.Up, row.Unknown, row.Down}})
+	}
+
+	aggregated := []SiteAvailabilityOutput{}
+
+	for _, average := range periods.Aggregate(rows, bucket) {
+		row := dated[average.First]
+		row.Date = average.Start.Format(ymdForm)
+		row.Up, row.Unknown, row.Down = average.Values[0], average.Values[1], average.Values[2]
+		row.Availability = periods.Availability(row.Up, row.Unknown, row.Down)
+		row.Reliability = periods.Reliability(row.Up, row.Unknown, row.Down)
+		aggregated = append(aggregated, row)
+	}
+
+	return aggregated
+}
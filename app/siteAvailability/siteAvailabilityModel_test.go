@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package siteAvailability
+
+import (
+	"github.com/argoeu/argo-web-api/utils/periods"
+	"github.com/argoeu/argo-web-api/utils/render"
+	"github.com/stretchr/testify/suite"
+	"labix.org/v2/mgo/bson"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type ModelTestSuite struct {
+	suite.Suite
+}
+
+// Monthly and yearly reports are grouped by the first six and four digits of
+// the daily documents, e.g. 201410 and 2014
+func (suite *ModelTestSuite) TestGroupByDate() {
+	input := SiteAvailabilityInput{
+		start_time:           "2014-01-01T00:00:00Z",
+		end_time:             "2015-12-31T23:59:59Z",
+		availability_profile: "ap1",
+	}
+
+	cases := []struct {
+		name   string
+		query  []bson.M
+		digits int
+	}{
+		{"monthly", Monthly(input), 6},
+		{"yearly", Yearly(input), 4},
+	}
+
+	for _, c := range cases {
+		group := c.query[1]["$group"].(bson.M)["_id"].(bson.M)
+		suite.Equal(bson.M{"$substr": list{"$dt", 0, c.digits}}, group["dt"], c.name)
+		suite.Equal("$_id.dt", c.query[2]["$project"].(bson.M)["dt"], c.name)
+	}
+}
+
+// A site reported in two scopes keeps a report per scope, which monthly and
+// yearly reports group by and project
+func (suite *ModelTestSuite) TestGroupByScope() {
+	query := Yearly(SiteAvailabilityInput{availability_profile: "ap1"})
+
+	group := query[1]["$group"].(bson.M)["_id"].(bson.M)
+	suite.Equal("$sc", group["sc"])
+	suite.Equal("$ss", group["ss"])
+
+	project := query[2]["$project"].(bson.M)
+	suite.Equal("$_id.sc", project["sc"])
+	suite.Equal("$_id.ss", project["ss"])
+
+	suite.Equal(bson.D{{"ns", 1}, {"ap", 1}, {"n", 1}, {"s", 1}, {"sc", 1}, {"ss", 1}, {"dt", 1}}, query[3]["$sort"])
+}
+
+// Days of a site in different scopes are averaged and rendered apart
+func (suite *ModelTestSuite) TestAggregateScopes() {
+	day := func(scope string, date string, up float64) SiteAvailabilityOutput {
+		return SiteAvailabilityOutput{Namespace: "ns1", Profile: "ap1", Ngi: "NGI_GRNET", Site: "HG-03-AUTH",
+			Scope: scope, SiteScope: scope, Date: date, Up: up, Unknown: 0, Down: 1 - up}
+	}
+
+	aggregated := aggregate([]SiteAvailabilityOutput{
+		day("EGI", "20141006", 1),
+		day("EGI", "20141007", 1),
+		day("Local", "20141006", 0),
+		day("Local", "20141007", 0.5),
+	}, periods.Weekly)
+
+	suite.Equal(2, len(aggregated))
+	suite.Equal("EGI", aggregated[0].Scope)
+	suite.Equal("EGI", aggregated[0].SiteScope)
+	suite.InDelta(1, aggregated[0].Up, 1e-9)
+	suite.Equal("Local", aggregated[1].Scope)
+	suite.Equal("Local", aggregated[1].SiteScope)
+	suite.InDelta(0.25, aggregated[1].Up, 1e-9)
+
+	output, _ := render.Marshal(render.CSV, createView(aggregated, render.CSV))
+	suite.Contains(string(output), "\nap1,HG-03-AUTH,NGI_GRNET,,EGI,EGI,,,,")
+	suite.Contains(string(output), "\nap1,HG-03-AUTH,NGI_GRNET,,Local,Local,,,,")
+
+	output, _ = render.Marshal(render.XML, createView(aggregated, render.XML))
+	suite.Contains(string(output), `<Site site="HG-03-AUTH" NGI="NGI_GRNET" infastructure="" scope="EGI" site_scope="EGI"`)
+	suite.Contains(string(output), `<Site site="HG-03-AUTH" NGI="NGI_GRNET" infastructure="" scope="Local" site_scope="Local"`)
+}
+
+func TestModelTestSuite(t *testing.T) {
+	suite.Run(t, new(ModelTestSuite))
+}
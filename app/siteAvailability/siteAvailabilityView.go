@@ -27,14 +27,18 @@
 package siteAvailability
 
 import (
-	"encoding/json"
-	"encoding/xml"
+	"bytes"
+	"encoding/csv"
 	"fmt"
-	"strings"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"time"
 )
 
-func createView(results []SiteAvailabilityOutput, format string) ([]byte, error) {
+func createView(results []SiteAvailabilityOutput, contentType string) interface{} {
+
+	if contentType == render.CSV {
+		return csvReport{results, customForm[0], customForm[1]}
+	}
 
 	docRoot := &Root{}
 
@@ -58,9 +62,9 @@ func createView(results []SiteAvailabilityOutput, format string) ([]byte, error)
 			docRoot.Profile = append(docRoot.Profile, profile)
 			prevSite = ""
 		}
-		//if new site does not match the previous service value
+		//if new site or its scopes do not match the previous ones
 		//we create a new site entry in the xml
-		if prevSite != row.Site {
+		if prevSite != row.Site || site.Scope != row.Scope || site.SiteScope != row.SiteScope {
 			prevSite = row.Site
 			site = &Site{
 				Site:          row.Site,
@@ -80,10 +84,41 @@ func createView(results []SiteAvailabilityOutput, format string) ([]byte, error)
 				Availability: fmt.Sprintf("%g", row.Availability),
 				Reliability:  fmt.Sprintf("%g", row.Reliability)})
 	}
-	if strings.ToLower(format) == "json" {
-		return json.MarshalIndent(docRoot, " ", "  ")
-	} else {
-		return xml.MarshalIndent(docRoot, " ", "  ")
+	return docRoot
+
+}
+
+func messageView(answer string) interface{} {
+	docRoot := &Message{}
+	docRoot.Message = answer
+	return docRoot
+}
+
+// csvReport writes one row per profile, site and timestamp straight from the
+// query results without building the document tree first, so that reports
+// spanning long periods are rendered with little memory overhead.
+type csvReport struct {
+	results []SiteAvailabilityOutput
+	dbForm  string
+	form    string
+}
+
+// MarshalCSV writes the report, see render.CSVMarshaler
+func (report csvReport) MarshalCSV() ([]byte, error) {
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	w.Write([]string{"profile", "site", "ngi", "infrastructure", "scope", "site_scope", "production", "monitored", "certification_status", "timestamp", "availability", "reliability"})
+
+	for _, row := range report.results {
+		timestamp, _ := time.Parse(report.dbForm, fmt.Sprint(row.Date))
+		w.Write([]string{row.Profile, row.Site, row.Ngi, row.Infastructure, row.Scope, row.SiteScope, row.Production, row.Monitored, row.CertStatus,
+			timestamp.Format(report.form),
+			fmt.Sprintf("%g", row.Availability),
+			fmt.Sprintf("%g", row.Reliability)})
 	}
 
+	w.Flush()
+	return b.Bytes(), w.Error()
 }
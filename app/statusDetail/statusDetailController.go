@@ -28,9 +28,11 @@ package statusDetail
 
 import (
 	//"bytes"
-	"fmt"
+	"github.com/argoeu/argo-web-api/utils/caches"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
+	"github.com/argoeu/argo-web-api/utils/render"
+	"github.com/argoeu/argo-web-api/utils/window"
 	"labix.org/v2/mgo/bson"
 	"net/http"
 	"strconv"
@@ -38,16 +40,15 @@ import (
 	"time"
 )
 
-func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("Hello there!")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
+	contentType := render.FromRequest(r)
 
 	//var buffer bytes.Buffer
 
@@ -65,6 +66,7 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		urlValues.Get("vo"),
 		urlValues.Get("profile"),
 		urlValues.Get("group_type"),
+		contentType,
 		group,
 	}
 
@@ -81,27 +83,50 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		input.vo = "ops"
 	}
 
+	found, output, stored := caches.Lookup("status_metrics", input, cfg)
+
+	if found {
+		h.Set("Last-Modified", stored.UTC().Format(http.TimeFormat))
+		return code, h, output, err
+	}
+
 	// Mongo Session
 	results := []StatusDetailOutput{}
 	poem_results := []PoemDetailOutput{}
 
 	session, err := mongo.OpenSession(cfg)
 
-	c := session.DB("AR").C("status_metric")
-	pc := session.DB("AR").C("poem_details")
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
+	c := repo.C("status_metric")
+	pc := repo.C("poem_details")
 
 	err = pc.Find(bson.M{"p": input.profile}).All(&poem_results)
-	err = c.Find(prepQuery(input)).All(&results)
 
-	mongo.CloseSession(session)
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	err = c.Find(prepQuery(input)).Sort("roc", "site", "srv", "h", "m", "di", "ti").All(&results)
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	output = createView(results, input, poem_results) //Respond renders the results into the negotiated format
 
-	output, err = createView(results, input, poem_results) //Render the results into XML format
-	//if strings.ToLower(input.format) == "json" {
-	//	contentType = "application/json"
-	//}
-	//buffer.WriteString(strconv.Itoa(len(results)))
-	//output = []byte(buffer.String())
-	h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+	if len(results) > 0 {
+		output = caches.Pending{Name: "status_metrics", Input: input, Document: output}
+	}
 
 	return code, h, output, err
 }
@@ -115,41 +140,24 @@ func prepQuery(input StatusDetailInput) bson.M {
 	ts, _ := time.Parse(zuluForm, input.start_time)
 	te, _ := time.Parse(zuluForm, input.end_time)
 	tsYMD, _ := strconv.Atoi(ts.Format(ymdForm))
-	//teYMD, _ := strconv.Atoi(te.Format(ymdForm))
+	teYMD, _ := strconv.Atoi(te.Format(ymdForm))
 
 	// parse time as integer
 	ts_int := (ts.Hour() * 10000) + (ts.Minute() * 100) + ts.Second()
 	te_int := (te.Hour() * 10000) + (te.Minute() * 100) + te.Second()
 
-	if input.group_type == "site" {
-
-		query := bson.M{
-			"di":   tsYMD,
-			"site": input.group,
-			"ti":   bson.M{"$gte": ts_int, "$lte": te_int},
-		}
-
-		return query
+	query := window.Query(tsYMD, ts_int, teYMD, te_int)
 
+	if input.group_type == "site" {
+		query["site"] = input.group
 	} else if input.group_type == "ngi" {
-		query := bson.M{
-			"di":  tsYMD,
-			"roc": input.group,
-			"ti":  bson.M{"$gte": ts_int, "$lte": te_int},
-		}
-
-		return query
-
+		query["roc"] = input.group
 	} else if input.group_type == "host" {
-		query := bson.M{
-			"di": tsYMD,
-			"h":  input.group,
-			"ti": bson.M{"$gte": ts_int, "$lte": te_int},
-		}
-
-		return query
+		query["h"] = input.group
+	} else {
+		return bson.M{"di": 0}
 	}
 
-	return bson.M{"di": 0}
+	return query
 
 }
@@ -34,6 +34,7 @@ type StatusDetailInput struct {
 	vo         string
 	profile    string
 	group_type string
+	format     string // negotiated media type of the response
 	group      string
 }
 
@@ -56,38 +57,38 @@ type PoemDetailOutput struct {
 }
 
 type ReadRoot struct {
-	XMLName xml.Name `xml:"root"`
-	Profile *Profile
+	XMLName xml.Name `xml:"root" json:"-"`
+	Profile *Profile `json:"profile,omitempty"`
 }
 
 type Profile struct {
-	XMLName xml.Name `xml:"profile"`
-	Name    string   `xml:"name,attr"`
-	Groups  []*Group
+	XMLName xml.Name `xml:"profile" json:"-"`
+	Name    string   `xml:"name,attr" json:"name"`
+	Groups  []*Group `json:"groups,omitempty"`
 }
 
 type Group struct {
-	XMLName xml.Name `xml:"group"`
-	Name    string   `xml:"name,attr"`
-	Type    string   `xml:"type,attr"`
-	Groups  []*Group
-	Hosts   []*Host
+	XMLName xml.Name `xml:"group" json:"-"`
+	Name    string   `xml:"name,attr" json:"name"`
+	Type    string   `xml:"type,attr" json:"type"`
+	Groups  []*Group `json:"groups,omitempty"`
+	Hosts   []*Host  `json:"hosts,omitempty"`
 }
 
 type Host struct {
-	XMLName xml.Name `xml:"host"`
-	Name    string   `xml:"name,attr"`
-	Metrics []*Metric
+	XMLName xml.Name  `xml:"host" json:"-"`
+	Name    string    `xml:"name,attr" json:"name"`
+	Metrics []*Metric `json:"metrics"`
 }
 
 type Metric struct {
-	XMLName  xml.Name `xml:"metric"`
-	Name     string   `xml:"name,attr"`
-	Timeline []*Status
+	XMLName  xml.Name  `xml:"metric" json:"-"`
+	Name     string    `xml:"name,attr" json:"name"`
+	Timeline []*Status `json:"timeline"`
 }
 
 type Status struct {
-	XMLName   xml.Name `xml:"status"`
-	Timestamp string   `xml:"timestamp,attr"`
-	Status    string   `xml:"status,attr"`
+	XMLName   xml.Name `xml:"status" json:"-"`
+	Timestamp string   `xml:"timestamp,attr" json:"timestamp"`
+	Status    string   `xml:"status,attr" json:"status"`
 }
@@ -26,15 +26,12 @@
 
 package statusDetail
 
-import "encoding/xml"
-
-func createView(results []StatusDetailOutput, input StatusDetailInput, poem_detail []PoemDetailOutput) ([]byte, error) {
+func createView(results []StatusDetailOutput, input StatusDetailInput, poem_detail []PoemDetailOutput) interface{} {
 
 	docRoot := &ReadRoot{}
 
 	if len(results) == 0 {
-		output, err := xml.MarshalIndent(docRoot, " ", "  ")
-		return output, err
+		return docRoot
 	}
 
 	profile := &Profile{}
@@ -68,6 +65,7 @@ func createView(results []StatusDetailOutput, input StatusDetailInput, poem_deta
 			vo.Groups = append(vo.Groups, roc)
 			prevRoc = roc.Name
 			pp_Roc = roc
+			prevSite = ""
 		}
 
 		if row.Site != prevSite && row.Site != "" {
@@ -77,6 +75,7 @@ func createView(results []StatusDetailOutput, input StatusDetailInput, poem_deta
 			pp_Roc.Groups = append(pp_Roc.Groups, site)
 			prevSite = row.Site
 			pp_Site = site
+			prevService = ""
 		}
 
 		if row.Service != prevService && row.Service != "" {
@@ -87,6 +86,7 @@ func createView(results []StatusDetailOutput, input StatusDetailInput, poem_deta
 
 			prevService = row.Service
 			pp_Service = service
+			prevHostname = ""
 		}
 
 		if row.Hostname != prevHostname && row.Hostname != "" {
@@ -95,6 +95,7 @@ func createView(results []StatusDetailOutput, input StatusDetailInput, poem_deta
 			pp_Service.Hosts = append(pp_Service.Hosts, host)
 			prevHostname = row.Hostname
 			pp_Host = host
+			prevMetric = ""
 		}
 
 		if row.Metric != prevMetric {
@@ -108,24 +109,24 @@ func createView(results []StatusDetailOutput, input StatusDetailInput, poem_deta
 			pp_Metric = metric
 
 			status := &Status{}
-			status.Timestamp = row.P_timestamp
+			status.Timestamp = input.start_time
 			status.Status = row.P_status
 			pp_Metric.Timeline = append(pp_Metric.Timeline, status)
-
-		} else {
-			status := &Status{}
-			status.Timestamp = row.Timestamp
-			status.Status = row.Status
-			pp_Metric.Timeline = append(pp_Metric.Timeline, status)
 		}
 
+		// Results are sorted by day and time so the statuses of consecutive
+		// days are appended one after the other into a single timeline
+		status := &Status{}
+		status.Timestamp = row.Timestamp
+		status.Status = row.Status
+		pp_Metric.Timeline = append(pp_Metric.Timeline, status)
+
 	}
 
 	profile.Groups = append(profile.Groups, vo)
 	docRoot.Profile = profile
 
-	output, err := xml.MarshalIndent(docRoot, " ", "  ")
-	return output, err
+	return docRoot
 
 }
 
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package statusDetail
+
+import (
+	"github.com/argoeu/argo-web-api/utils/render"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type ViewTestSuite struct {
+	suite.Suite
+	input StatusDetailInput
+	poem  []PoemDetailOutput
+}
+
+func (suite *ViewTestSuite) SetupTest() {
+	suite.input = StatusDetailInput{
+		start_time: "2015-04-30T00:00:00Z",
+		end_time:   "2015-05-01T23:59:59Z",
+		vo:         "ops",
+		profile:    "ch.cern.sam.ROC_CRITICAL",
+	}
+	suite.poem = []PoemDetailOutput{{Service: "CREAM-CE", Metric: "emi.cream.CREAMCE-JobSubmit"}}
+}
+
+// The rows of every day of the window end up in a single timeline, which
+// starts at start_time with the status the metric had before the window
+func (suite *ViewTestSuite) TestMultiDay() {
+
+	results := []StatusDetailOutput{
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Service: "CREAM-CE", Hostname: "cream01.afroditi.gr", Metric: "emi.cream.CREAMCE-JobSubmit",
+			Timestamp: "2015-04-30T05:00:00Z", Status: "OK", P_status: "UNKNOWN"},
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Service: "CREAM-CE", Hostname: "cream01.afroditi.gr", Metric: "emi.cream.CREAMCE-JobSubmit",
+			Timestamp: "2015-04-30T21:00:00Z", Status: "CRITICAL", P_status: "OK"},
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Service: "CREAM-CE", Hostname: "cream01.afroditi.gr", Metric: "emi.cream.CREAMCE-JobSubmit",
+			Timestamp: "2015-05-01T03:00:00Z", Status: "OK", P_status: "CRITICAL"},
+	}
+
+	output, err := render.Marshal(render.XML, createView(results, suite.input, suite.poem))
+	suite.Nil(err)
+	suite.Equal(` <root>
+   <profile name="ch.cern.sam.ROC_CRITICAL">
+     <group name="ops" type="vo">
+       <group name="NGI_GRNET" type="ngi">
+         <group name="HG-03-AUTH" type="site">
+           <group name="CREAM-CE" type="service_type">
+             <host name="cream01.afroditi.gr">
+               <metric name="emi.cream.CREAMCE-JobSubmit">
+                 <status timestamp="2015-04-30T00:00:00Z" status="UNKNOWN"></status>
+                 <status timestamp="2015-04-30T05:00:00Z" status="OK"></status>
+                 <status timestamp="2015-04-30T21:00:00Z" status="CRITICAL"></status>
+                 <status timestamp="2015-05-01T03:00:00Z" status="OK"></status>
+               </metric>
+             </host>
+           </group>
+         </group>
+       </group>
+     </group>
+   </profile>
+ </root>`, string(output))
+}
+
+// A metric of a new host starts a new timeline seeded with its own previous
+// status, even when the metric has the name of the one before it. Metrics
+// missing from the poem profile are left out.
+func (suite *ViewTestSuite) TestNewParent() {
+
+	results := []StatusDetailOutput{
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Service: "CREAM-CE", Hostname: "cream01.afroditi.gr", Metric: "emi.cream.CREAMCE-JobSubmit",
+			Timestamp: "2015-04-30T05:00:00Z", Status: "OK", P_status: "UNKNOWN"},
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Service: "CREAM-CE", Hostname: "cream02.afroditi.gr", Metric: "emi.cream.CREAMCE-JobSubmit",
+			Timestamp: "2015-05-01T01:00:00Z", Status: "WARNING", P_status: "OK"},
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Service: "CREAM-CE", Hostname: "cream02.afroditi.gr", Metric: "org.nagios.Other",
+			Timestamp: "2015-05-01T02:00:00Z", Status: "CRITICAL", P_status: "OK"},
+	}
+
+	output, err := render.Marshal(render.XML, createView(results, suite.input, suite.poem))
+	suite.Nil(err)
+	suite.Equal(` <root>
+   <profile name="ch.cern.sam.ROC_CRITICAL">
+     <group name="ops" type="vo">
+       <group name="NGI_GRNET" type="ngi">
+         <group name="HG-03-AUTH" type="site">
+           <group name="CREAM-CE" type="service_type">
+             <host name="cream01.afroditi.gr">
+               <metric name="emi.cream.CREAMCE-JobSubmit">
+                 <status timestamp="2015-04-30T00:00:00Z" status="UNKNOWN"></status>
+                 <status timestamp="2015-04-30T05:00:00Z" status="OK"></status>
+               </metric>
+             </host>
+             <host name="cream02.afroditi.gr">
+               <metric name="emi.cream.CREAMCE-JobSubmit">
+                 <status timestamp="2015-04-30T00:00:00Z" status="OK"></status>
+                 <status timestamp="2015-05-01T01:00:00Z" status="WARNING"></status>
+               </metric>
+             </host>
+           </group>
+         </group>
+       </group>
+     </group>
+   </profile>
+ </root>`, string(output))
+}
+
+// No results give an empty document
+func (suite *ViewTestSuite) TestEmpty() {
+	output, err := render.Marshal(render.XML, createView(nil, suite.input, suite.poem))
+	suite.Nil(err)
+	suite.Equal(` <root></root>`, string(output))
+}
+
+func TestViewTestSuite(t *testing.T) {
+	suite.Run(t, new(ViewTestSuite))
+}
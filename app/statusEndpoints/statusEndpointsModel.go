@@ -34,6 +34,7 @@ type StatusEndpointsInput struct {
 	vo         string
 	profile    string
 	group_type string
+	format     string // negotiated media type of the response
 	group      string
 }
 
@@ -50,33 +51,33 @@ type StatusEndpointsOutput struct {
 }
 
 type ReadRoot struct {
-	XMLName xml.Name `xml:"root"`
-	Profile *Profile
+	XMLName xml.Name `xml:"root" json:"-"`
+	Profile *Profile `json:"profile,omitempty"`
 }
 
 type Profile struct {
-	XMLName xml.Name `xml:"profile"`
-	Name    string   `xml:"name,attr"`
-	Groups  []*Group
+	XMLName xml.Name `xml:"profile" json:"-"`
+	Name    string   `xml:"name,attr" json:"name"`
+	Groups  []*Group `json:"groups,omitempty"`
 }
 
 type Group struct {
-	XMLName   xml.Name `xml:"group"`
-	Name      string   `xml:"name,attr"`
-	Type      string   `xml:"type,attr"`
-	Groups    []*Group
-	Endpoints []*Endpoint
+	XMLName   xml.Name    `xml:"group" json:"-"`
+	Name      string      `xml:"name,attr" json:"name"`
+	Type      string      `xml:"type,attr" json:"type"`
+	Groups    []*Group    `json:"groups,omitempty"`
+	Endpoints []*Endpoint `json:"endpoints,omitempty"`
 }
 
 type Endpoint struct {
-	XMLName  xml.Name `xml:"endpoint"`
-	Hostname string   `xml:"hostname,attr"`
-	Service  string   `xml:"service,attr"`
-	Timeline []*Status
+	XMLName  xml.Name  `xml:"endpoint" json:"-"`
+	Hostname string    `xml:"hostname,attr" json:"hostname"`
+	Service  string    `xml:"service,attr" json:"service"`
+	Timeline []*Status `json:"timeline"`
 }
 
 type Status struct {
-	XMLName   xml.Name `xml:"status"`
-	Timestamp string   `xml:"timestamp,attr"`
-	Status    string   `xml:"status,attr"`
+	XMLName   xml.Name `xml:"status" json:"-"`
+	Timestamp string   `xml:"timestamp,attr" json:"timestamp"`
+	Status    string   `xml:"status,attr" json:"status"`
 }
@@ -26,15 +26,12 @@
 
 package statusEndpoints
 
-import "encoding/xml"
-
-func createView(results []StatusEndpointsOutput, input StatusEndpointsInput) ([]byte, error) {
+func createView(results []StatusEndpointsOutput, input StatusEndpointsInput) interface{} {
 
 	docRoot := &ReadRoot{}
 
 	if len(results) == 0 {
-		output, err := xml.MarshalIndent(docRoot, " ", "  ")
-		return output, err
+		return docRoot
 	}
 
 	profile := &Profile{}
@@ -67,6 +64,7 @@ func createView(results []StatusEndpointsOutput, input StatusEndpointsInput) ([]
 			vo.Groups = append(vo.Groups, roc)
 			prevRoc = roc.Name
 			pp_Roc = roc
+			prevSite = ""
 		}
 
 		if row.Site != prevSite && row.Site != "" {
@@ -76,6 +74,7 @@ func createView(results []StatusEndpointsOutput, input StatusEndpointsInput) ([]
 			pp_Roc.Groups = append(pp_Roc.Groups, site)
 			prevSite = row.Site
 			pp_Site = site
+			prevService = ""
 		}
 
 		if row.Service != prevService && row.Service != "" {
@@ -86,6 +85,7 @@ func createView(results []StatusEndpointsOutput, input StatusEndpointsInput) ([]
 
 			prevService = row.Service
 			pp_Service = service
+			prevHostname = ""
 		}
 
 		if row.Hostname != prevHostname {
@@ -104,20 +104,20 @@ func createView(results []StatusEndpointsOutput, input StatusEndpointsInput) ([]
 			status.Timestamp = input.start_time
 			status.Status = row.P_status
 			pp_Endpoint.Timeline = append(pp_Endpoint.Timeline, status)
-
-		} else {
-			status := &Status{}
-			status.Timestamp = row.Timestamp
-			status.Status = row.Status
-			pp_Endpoint.Timeline = append(pp_Endpoint.Timeline, status)
 		}
 
+		// Results are sorted by day and time so the statuses of consecutive
+		// days are appended one after the other into a single timeline
+		status := &Status{}
+		status.Timestamp = row.Timestamp
+		status.Status = row.Status
+		pp_Endpoint.Timeline = append(pp_Endpoint.Timeline, status)
+
 	}
 
 	profile.Groups = append(profile.Groups, vo)
 	docRoot.Profile = profile
 
-	output, err := xml.MarshalIndent(docRoot, " ", "  ")
-	return output, err
+	return docRoot
 
 }
@@ -28,9 +28,10 @@ package statusMsg
 
 import (
 	//"bytes"
-	"fmt"
+	"github.com/argoeu/argo-web-api/utils/caches"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"labix.org/v2/mgo/bson"
 	"net/http"
 	"strconv"
@@ -38,16 +39,15 @@ import (
 	"time"
 )
 
-func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error) {
+func List(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error) {
 
 	//STANDARD DECLARATIONS START
 
 	code := http.StatusOK
 	h := http.Header{}
-	output := []byte("Hello there!")
+	output := interface{}(nil)
 	err := error(nil)
-	contentType := "text/xml"
-	charset := "utf-8"
+	contentType := render.FromRequest(r)
 
 	//var buffer bytes.Buffer
 
@@ -65,6 +65,7 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		urlValues.Get("exec_time"),
 		urlValues.Get("vo"),
 		urlValues.Get("profile"),
+		contentType,
 		hostname,
 		service,
 		metric,
@@ -79,27 +80,50 @@ func List(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)
 		input.vo = "ops"
 	}
 
+	found, output, stored := caches.Lookup("status_msg", input, cfg)
+
+	if found {
+		h.Set("Last-Modified", stored.UTC().Format(http.TimeFormat))
+		return code, h, output, err
+	}
+
 	// Mongo Session
 	results := []StatusMsgOutput{}
 	poem_results := []PoemDetailOutput{}
 
 	session, err := mongo.OpenSession(cfg)
 
-	c := session.DB("AR").C("status_metric")
-	pc := session.DB("AR").C("poem_details")
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
+	c := repo.C("status_metric")
+	pc := repo.C("poem_details")
 
 	err = pc.Find(bson.M{"p": input.profile}).All(&poem_results)
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
 	err = c.Find(prepQuery(input)).All(&results)
 
-	mongo.CloseSession(session)
+	if err != nil {
+		code = http.StatusInternalServerError
+		return code, h, output, err
+	}
+
+	output = createView(results, input, poem_results) //Respond renders the results into the negotiated format
 
-	output, err = createView(results, input, poem_results) //Render the results into XML format
-	//if strings.ToLower(input.format) == "json" {
-	//	contentType = "application/json"
-	//}
-	//buffer.WriteString(strconv.Itoa(len(results)))
-	//output = []byte(buffer.String())
-	h.Set("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, charset))
+	if len(results) > 0 {
+		output = caches.Pending{Name: "status_msg", Input: input, Document: output}
+	}
 
 	return code, h, output, err
 }
@@ -26,15 +26,12 @@
 
 package statusMsg
 
-import "encoding/xml"
-
-func createView(results []StatusMsgOutput, input StatusMsgInput, poem_detail []PoemDetailOutput) ([]byte, error) {
+func createView(results []StatusMsgOutput, input StatusMsgInput, poem_detail []PoemDetailOutput) interface{} {
 
 	docRoot := &ReadRoot{}
 
 	if len(results) == 0 {
-		output, err := xml.MarshalIndent(docRoot, " ", "  ")
-		return output, err
+		return docRoot
 	}
 
 	profile := &Profile{}
@@ -130,8 +127,7 @@ func createView(results []StatusMsgOutput, input StatusMsgInput, poem_detail []P
 	profile.Groups = append(profile.Groups, vo)
 	docRoot.Profile = profile
 
-	output, err := xml.MarshalIndent(docRoot, " ", "  ")
-	return output, err
+	return docRoot
 
 }
 
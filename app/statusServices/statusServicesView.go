@@ -26,15 +26,12 @@
 
 package statusServices
 
-import "encoding/xml"
-
-func createView(results []StatusServicesOutput, input StatusServicesInput) ([]byte, error) {
+func createView(results []StatusServicesOutput, input StatusServicesInput) interface{} {
 
 	docRoot := &ReadRoot{}
 
 	if len(results) == 0 {
-		output, err := xml.MarshalIndent(docRoot, " ", "  ")
-		return output, err
+		return docRoot
 	}
 
 	profile := &Profile{}
@@ -65,6 +62,7 @@ func createView(results []StatusServicesOutput, input StatusServicesInput) ([]by
 			vo.Groups = append(vo.Groups, roc)
 			prevRoc = roc.Name
 			pp_Roc = roc
+			prevSite = ""
 		}
 
 		if row.Site != prevSite && row.Site != "" {
@@ -74,6 +72,7 @@ func createView(results []StatusServicesOutput, input StatusServicesInput) ([]by
 			pp_Roc.Groups = append(pp_Roc.Groups, site)
 			prevSite = row.Site
 			pp_Site = site
+			prevService = ""
 		}
 
 		if row.Service != prevService {
@@ -91,20 +90,20 @@ func createView(results []StatusServicesOutput, input StatusServicesInput) ([]by
 			status.Timestamp = input.start_time
 			status.Status = row.P_status
 			pp_Service.Timeline = append(pp_Service.Timeline, status)
-
-		} else {
-			status := &Status{}
-			status.Timestamp = row.Timestamp
-			status.Status = row.Status
-			pp_Service.Timeline = append(pp_Service.Timeline, status)
 		}
 
+		// Results are sorted by day and time so the statuses of consecutive
+		// days are appended one after the other into a single timeline
+		status := &Status{}
+		status.Timestamp = row.Timestamp
+		status.Status = row.Status
+		pp_Service.Timeline = append(pp_Service.Timeline, status)
+
 	}
 
 	profile.Groups = append(profile.Groups, vo)
 	docRoot.Profile = profile
 
-	output, err := xml.MarshalIndent(docRoot, " ", "  ")
-	return output, err
+	return docRoot
 
 }
@@ -34,6 +34,7 @@ type StatusSitesInput struct {
 	vo         string
 	profile    string
 	group_type string
+	format     string // negotiated media type of the response
 	group      string
 }
 
@@ -48,32 +49,32 @@ type StatusSitesOutput struct {
 }
 
 type ReadRoot struct {
-	XMLName xml.Name `xml:"root"`
-	Profile *Profile
+	XMLName xml.Name `xml:"root" json:"-"`
+	Profile *Profile `json:"profile,omitempty"`
 }
 
 type Profile struct {
-	XMLName xml.Name `xml:"profile"`
-	Name    string   `xml:"name,attr"`
-	Groups  []*Group
+	XMLName xml.Name `xml:"profile" json:"-"`
+	Name    string   `xml:"name,attr" json:"name"`
+	Groups  []*Group `json:"groups,omitempty"`
 }
 
 type Group struct {
-	XMLName xml.Name `xml:"group"`
-	Name    string   `xml:"name,attr"`
-	Type    string   `xml:"type,attr"`
-	Groups  []*Group
-	Sites   []*Site
+	XMLName xml.Name `xml:"group" json:"-"`
+	Name    string   `xml:"name,attr" json:"name"`
+	Type    string   `xml:"type,attr" json:"type"`
+	Groups  []*Group `json:"groups,omitempty"`
+	Sites   []*Site  `json:"sites,omitempty"`
 }
 
 type Site struct {
-	XMLName  xml.Name `xml:"endpoint"`
-	Name     string   `xml:"name,attr"`
-	Timeline []*Status
+	XMLName  xml.Name  `xml:"endpoint" json:"-"`
+	Name     string    `xml:"name,attr" json:"name"`
+	Timeline []*Status `json:"timeline"`
 }
 
 type Status struct {
-	XMLName   xml.Name `xml:"status"`
-	Timestamp string   `xml:"timestamp,attr"`
-	Status    string   `xml:"status,attr"`
+	XMLName   xml.Name `xml:"status" json:"-"`
+	Timestamp string   `xml:"timestamp,attr" json:"timestamp"`
+	Status    string   `xml:"status,attr" json:"status"`
 }
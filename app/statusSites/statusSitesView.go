@@ -26,15 +26,12 @@
 
 package statusSites
 
-import "encoding/xml"
-
-func createView(results []StatusSitesOutput, input StatusSitesInput) ([]byte, error) {
+func createView(results []StatusSitesOutput, input StatusSitesInput) interface{} {
 
 	docRoot := &ReadRoot{}
 
 	if len(results) == 0 {
-		output, err := xml.MarshalIndent(docRoot, " ", "  ")
-		return output, err
+		return docRoot
 	}
 
 	profile := &Profile{}
@@ -63,6 +60,7 @@ func createView(results []StatusSitesOutput, input StatusSitesInput) ([]byte, er
 			vo.Groups = append(vo.Groups, roc)
 			prevRoc = roc.Name
 			pp_Roc = roc
+			prevSite = ""
 		}
 
 		if row.Site != prevSite {
@@ -80,20 +78,20 @@ func createView(results []StatusSitesOutput, input StatusSitesInput) ([]byte, er
 			status.Timestamp = input.start_time
 			status.Status = row.P_status
 			pp_Site.Timeline = append(pp_Site.Timeline, status)
-
-		} else {
-			status := &Status{}
-			status.Timestamp = row.Timestamp
-			status.Status = row.Status
-			pp_Site.Timeline = append(pp_Site.Timeline, status)
 		}
 
+		// Results are sorted by day and time so the statuses of consecutive
+		// days are appended one after the other into a single timeline
+		status := &Status{}
+		status.Timestamp = row.Timestamp
+		status.Status = row.Status
+		pp_Site.Timeline = append(pp_Site.Timeline, status)
+
 	}
 
 	profile.Groups = append(profile.Groups, vo)
 	docRoot.Profile = profile
 
-	output, err := xml.MarshalIndent(docRoot, " ", "  ")
-	return output, err
+	return docRoot
 
 }
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package statusSites
+
+import (
+	"github.com/argoeu/argo-web-api/utils/render"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type ViewTestSuite struct {
+	suite.Suite
+}
+
+// Every site gets a single timeline over all the days of the window, which
+// starts at start_time with the status the site had before the window. A
+// site of a new ngi starts over even when it has the name of the one before.
+func (suite *ViewTestSuite) TestTimeline() {
+
+	input := StatusSitesInput{
+		start_time: "2015-04-30T00:00:00Z",
+		end_time:   "2015-05-01T23:59:59Z",
+		vo:         "ops",
+		profile:    "ch.cern.sam.ROC_CRITICAL",
+	}
+
+	results := []StatusSitesOutput{
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Profile: "ch.cern.sam.ROC_CRITICAL", Timestamp: "2015-04-30T05:00:00Z", Status: "OK", P_status: "UNKNOWN"},
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Profile: "ch.cern.sam.ROC_CRITICAL", Timestamp: "2015-05-01T03:00:00Z", Status: "CRITICAL", P_status: "OK"},
+		{Roc: "NGI_GRNET", Site: "HG-03-AUTH", Profile: "ch.cern.sam.OPS_MONITOR", Timestamp: "2015-05-01T04:00:00Z", Status: "OK", P_status: "OK"},
+		{Roc: "NGI_IT", Site: "HG-03-AUTH", Profile: "ch.cern.sam.ROC_CRITICAL", Timestamp: "2015-05-01T06:00:00Z", Status: "WARNING", P_status: "CRITICAL"},
+	}
+
+	output, err := render.Marshal(render.XML, createView(results, input))
+	suite.Nil(err)
+	suite.Equal(` <root>
+   <profile name="ch.cern.sam.ROC_CRITICAL">
+     <group name="ops" type="vo">
+       <group name="NGI_GRNET" type="ngi">
+         <endpoint name="HG-03-AUTH">
+           <status timestamp="2015-04-30T00:00:00Z" status="UNKNOWN"></status>
+           <status timestamp="2015-04-30T05:00:00Z" status="OK"></status>
+           <status timestamp="2015-05-01T03:00:00Z" status="CRITICAL"></status>
+         </endpoint>
+       </group>
+       <group name="NGI_IT" type="ngi">
+         <endpoint name="HG-03-AUTH">
+           <status timestamp="2015-04-30T00:00:00Z" status="CRITICAL"></status>
+           <status timestamp="2015-05-01T06:00:00Z" status="WARNING"></status>
+         </endpoint>
+       </group>
+     </group>
+   </profile>
+ </root>`, string(output))
+}
+
+func TestViewTestSuite(t *testing.T) {
+	suite.Run(t, new(ViewTestSuite))
+}
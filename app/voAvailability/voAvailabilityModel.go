@@ -28,6 +28,7 @@ package voAvailability
 
 import (
 	"encoding/xml"
+	"github.com/argoeu/argo-web-api/utils/periods"
 	"labix.org/v2/mgo/bson"
 	"strconv"
 	"time"
@@ -57,14 +58,20 @@ type Root struct {
 	Profile []*Profile
 }
 
+type Message struct {
+	XMLName xml.Name `xml:"root" json:"-"`
+	Message string   `json:"message"`
+}
+
 type ApiVoAvailabilityInProfileInput struct {
 	// mandatory values
 	start_time           string // UTC time in W3C format
 	end_time             string // UTC time in W3C format
 	availability_profile string //availability profile
-	granularity          string // availability period; possible values: `DAILY`  `MONTHLY`
+	granularity          string // availability period; possible values: `DAILY`, `WEEKLY`, `MONTHLY`, `YEARLY`
+	period               string // custom ISO 8601 aggregation period, e.g. `P7D`, `P1M`, `P3M`; overrides granularity
 	// optional values
-	format     string   // default XML; possible values are: XML, JSON
+	format     string   // negotiated media type of the response
 	group_name []string // site name; may appear more than once
 }
 
@@ -74,6 +81,9 @@ type ApiVoAvailabilityInProfileOutput struct {
 	Vo           string  `bson:"v"`
 	Availability float64 `bson:"a"`
 	Reliability  float64 `bson:"r"`
+	Up           float64 `bson:"up"`
+	Unknown      float64 `bson:"u"`
+	Down         float64 `bson:"d"`
 }
 
 type list []interface{}
@@ -119,12 +129,32 @@ func Daily(input ApiVoAvailabilityInProfileInput) []bson.M {
 	return query
 }
 
+func Days(input ApiVoAvailabilityInProfileInput) []bson.M {
+
+	filter := prepareFilter(input)
+
+	query := []bson.M{
+		{"$match": filter},
+		{"$project": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 8}}}, "ap": 1, "v": 1, "up": 1, "u": 1, "d": 1}},
+		{"$sort": bson.D{{"ap", 1}, {"v", 1}, {"dt", 1}}}}
+
+	return query
+}
+
 func Monthly(input ApiVoAvailabilityInProfileInput) []bson.M {
+	return groupByDate(input, 6)
+}
+
+func Yearly(input ApiVoAvailabilityInProfileInput) []bson.M {
+	return groupByDate(input, 4)
+}
+
+func groupByDate(input ApiVoAvailabilityInProfileInput, digits int) []bson.M {
 	filter := prepareFilter(input)
 
 	query := []bson.M{
 		{"$match": filter},
-		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, 6}}}, "ap": "$ap", "v": "$v"},
+		{"$group": bson.M{"_id": bson.M{"dt": bson.D{{"$substr", list{"$dt", 0, digits}}}, "ap": "$ap", "v": "$v"},
 			"avgup": bson.M{"$avg": "$up"}, "avgu": bson.M{"$avg": "$u"}, "avgd": bson.M{"$avg": "$d"}}},
 		{"$project": bson.M{"dt": "$_id.dt", "v": "$_id.v", "ap": "$_id.ap",
 			"a": bson.M{"$multiply": list{bson.M{"$divide": list{"$avgup", bson.M{"$subtract": list{1.00000001, "$avgu"}}}}, 100}},
@@ -133,3 +163,35 @@ func Monthly(input ApiVoAvailabilityInProfileInput) []bson.M {
 
 	return query
 }
+
+// aggregate averages the daily uptime, unknown and downtime fractions of each
+// vo over the period that bucket assigns every day to and computes the
+// availability and reliability of the period the same way Monthly does.
+// The results must be sorted by vo and date.
+func aggregate(results []ApiVoAvailabilityInProfileOutput, bucket periods.Bucketer) []ApiVoAvailabilityInProfileOutput {
+
+	dated := []ApiVoAvailabilityInProfileOutput{}
+	rows := []periods.Row{}
+
+	for _, row := range results {
+		day, err := time.Parse(ymdForm, row.Date)
+		if err != nil {
+			continue
+		}
+		dated = append(dated, row)
+		rows = append(rows, periods.Row{Key: [2]string{row.Profile, row.Vo}, Day: day, Values: []float64{row.Up, row.Unknown, row.Down}})
+	}
+
+	aggregated := []ApiVoAvailabilityInProfileOutput{}
+
+	for _, average := range periods.Aggregate(rows, bucket) {
+		row := dated[average.First]
+		row.Date = average.Start.Format(ymdForm)
+		row.Up, row.Unknown, row.Down = average.Values[0], average.Values[1], average.Values[2]
+		row.Availability = periods.Availability(row.Up, row.Unknown, row.Down)
+		row.Reliability = periods.Reliability(row.Up, row.Unknown, row.Down)
+		aggregated = append(aggregated, row)
+	}
+
+	return aggregated
+}
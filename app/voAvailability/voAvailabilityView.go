@@ -27,14 +27,18 @@
 package voAvailability
 
 import (
-	"encoding/json"
-	"encoding/xml"
+	"bytes"
+	"encoding/csv"
 	"fmt"
-	"strings"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"time"
 )
 
-func createView(results []ApiVoAvailabilityInProfileOutput, format string) ([]byte, error) {
+func createView(results []ApiVoAvailabilityInProfileOutput, contentType string) interface{} {
+
+	if contentType == render.CSV {
+		return csvReport{results, customForm[0], customForm[1]}
+	}
 	docRoot := &Root{}
 
 	prevProfile := ""
@@ -71,11 +75,42 @@ func createView(results []ApiVoAvailabilityInProfileOutput, format string) ([]by
 				Availability: fmt.Sprintf("%g", row.Availability),
 				Reliability:  fmt.Sprintf("%g", row.Reliability)})
 	}
-	//we create the xml response and record the output and any possible errors
-	//in the appropriate variables
-	if strings.ToLower(format) == "json" {
-		return json.MarshalIndent(docRoot, " ", "  ")
-	} else {
-		return xml.MarshalIndent(docRoot, " ", "  ")
+	//we render the response into the negotiated format and record the output
+	//and any possible errors in the appropriate variables
+	return docRoot
+}
+
+func messageView(answer string) interface{} {
+	docRoot := &Message{}
+	docRoot.Message = answer
+	return docRoot
+}
+
+// csvReport writes one row per profile, vo and timestamp straight from the
+// query results without building the document tree first, so that reports
+// spanning long periods are rendered with little memory overhead.
+type csvReport struct {
+	results []ApiVoAvailabilityInProfileOutput
+	dbForm  string
+	form    string
+}
+
+// MarshalCSV writes the report, see render.CSVMarshaler
+func (report csvReport) MarshalCSV() ([]byte, error) {
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	w.Write([]string{"profile", "vo", "timestamp", "availability", "reliability"})
+
+	for _, row := range report.results {
+		timestamp, _ := time.Parse(report.dbForm, row.Date)
+		w.Write([]string{row.Profile, row.Vo,
+			timestamp.Format(report.form),
+			fmt.Sprintf("%g", row.Availability),
+			fmt.Sprintf("%g", row.Reliability)})
 	}
+
+	w.Flush()
+	return b.Bytes(), w.Error()
 }
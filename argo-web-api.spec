@@ -34,6 +34,9 @@ install --mode 755 bin/argo-web-api %{buildroot}/var/www/argo-web-api/argo-web-a
 install --directory %{buildroot}/etc/init
 install --mode 644 src/github.com/argoeu/argo-web-api/argo-web-api.conf %{buildroot}/etc/init/
 
+install --directory %{buildroot}/etc/argo-web-api
+install --mode 644 src/github.com/argoeu/argo-web-api/argo-web-api.example.ini %{buildroot}/etc/argo-web-api/
+
 %clean
 %{__rm} -rf %{buildroot}
 export GOPATH=$PWD
@@ -45,6 +48,7 @@ go clean
 %attr(0750,root,root) /var/www/argo-web-api
 %attr(0755,root,root) /var/www/argo-web-api/argo-web-api
 %attr(0644,root,root) /etc/init/argo-web-api.conf
+%attr(0644,root,root) /etc/argo-web-api/argo-web-api.example.ini
 
 %changelog
 * Fri May 28 2015 Pavlos Daoglou <pdaog@grid.auth.gr> 1.6.0-1%{?dist}
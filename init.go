@@ -28,22 +28,12 @@ package main
 
 import (
 	"github.com/argoeu/argo-web-api/utils/config"
-	"github.com/argoeu/go-lru-cache"
 	"log"
 	"os"
-	"os/signal"
 	"runtime"
 	"runtime/pprof"
 )
 
-var httpcache *cache.LRUCache
-
-type mystring string
-
-func (s mystring) Size() int {
-	return len(s)
-}
-
 // Load the configurations that we have set through flags and through the configuration file
 var cfg = config.LoadConfiguration()
 
@@ -56,9 +46,6 @@ func init() {
 		}
 	}()
 
-	//Initialize the cache
-	httpcache = cache.NewLRUCache(uint64(cfg.Server.Lrucache))
-
 	//Set GOMAXPROCS
 	runtime.GOMAXPROCS(cfg.Server.Maxprocs)
 
@@ -68,21 +55,7 @@ func init() {
 		if err != nil {
 			log.Fatal(err)
 		}
+		//The profiler is stopped when the server shuts down
 		pprof.StartCPUProfile(f)
-		defer pprof.StopCPUProfile()
 	}
-
-	//Catch an terminate signal and write all profiling data before exiting
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for sig := range c {
-			// sig is a ^C, handle it
-			if cfg.Profile != "" {
-				pprof.StopCPUProfile()
-			}
-			log.Printf("captured %v, stopping profiler and exiting..", sig)
-			os.Exit(1)
-		}
-	}()
 }
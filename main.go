@@ -27,12 +27,17 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"github.com/argoeu/argo-web-api/app/audit"
 	"github.com/argoeu/argo-web-api/app/availabilityProfiles"
+	"github.com/argoeu/argo-web-api/app/cache"
 	"github.com/argoeu/argo-web-api/app/factors"
+	"github.com/argoeu/argo-web-api/app/keys"
 	"github.com/argoeu/argo-web-api/app/ngiAvailability"
 	"github.com/argoeu/argo-web-api/app/poemProfiles"
 	"github.com/argoeu/argo-web-api/app/recomputations"
+	"github.com/argoeu/argo-web-api/app/scopes"
 	"github.com/argoeu/argo-web-api/app/serviceFlavorAvailability"
 	"github.com/argoeu/argo-web-api/app/siteAvailability"
 	"github.com/argoeu/argo-web-api/app/statusDetail"
@@ -41,70 +46,116 @@ import (
 	"github.com/argoeu/argo-web-api/app/statusServices"
 	"github.com/argoeu/argo-web-api/app/statusSites"
 	"github.com/argoeu/argo-web-api/app/voAvailability"
+	"github.com/argoeu/argo-web-api/utils/authentication"
+	"github.com/argoeu/argo-web-api/utils/mongo"
+	"github.com/argoeu/argo-web-api/utils/render"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime/pprof"
 	"strconv"
+	"syscall"
+	"time"
 )
 
+// Time given to the requests in flight to complete when shutting down
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 
+	//Connect to MongoDB once, requests share the connection pool
+	if err := mongo.InitSession(cfg); err != nil {
+		log.Fatal("MongoDB:", err)
+	}
+
+	//Keys inserted by hand with a plaintext apiKey are stored hashed from now on
+	if migrated, err := authentication.MigrateKeys(cfg); err != nil {
+		log.Fatal("API keys:", err)
+	} else if migrated > 0 {
+		log.Printf("hashed %d plaintext API keys", migrated)
+	}
+
 	//Create the server router
 	mainRouter := mux.NewRouter()
 	//SUBROUTER DEFINITIONS
-	getSubrouter := mainRouter.Methods("GET").Subrouter()                                //Routes only GET requests
-	postSubrouter := mainRouter.Methods("POST").Headers("x-api-key", "").Subrouter()     //Routes only POST requests
-	deleteSubrouter := mainRouter.Methods("DELETE").Headers("x-api-key", "").Subrouter() //Routes only DELETE requests
-	putSubrouter := mainRouter.Methods("PUT").Headers("x-api-key", "").Subrouter()       //Routes only PUT requests
-	//All requests that modify data must provide with authentication credentials
+	getSubrouter := mainRouter.Methods("GET").Subrouter()       //Routes only GET requests
+	postSubrouter := mainRouter.Methods("POST").Subrouter()     //Routes only POST requests
+	deleteSubrouter := mainRouter.Methods("DELETE").Subrouter() //Routes only DELETE requests
+	putSubrouter := mainRouter.Methods("PUT").Subrouter()       //Routes only PUT requests
+	patchSubrouter := mainRouter.Methods("PATCH").Subrouter()   //Routes only PATCH requests
+	//All requests that modify data must provide with authentication credentials,
+	//either an x-api-key header or a client certificate
+	//GET routes are named after the [cachecontrol] setting that applies to them
 
 	// Grouping calls.
 	// Groups are routed depending on the value of the parameter group type.
 	// 2) Provide with a default call informing the user of an invalid parameter
-	getSubrouter.HandleFunc("/api/v1/group_availability", Respond(voAvailability.List)).
+	getSubrouter.HandleFunc("/api/v1/group_availability", Respond(voAvailability.List)).Name("group_availability").
 		Queries("group_type", "vo")
-	getSubrouter.HandleFunc("/api/v1/group_availability", Respond(siteAvailability.List)).
+	getSubrouter.HandleFunc("/api/v1/group_availability", Respond(siteAvailability.List)).Name("group_availability").
 		Queries("group_type", "site")
-	getSubrouter.HandleFunc("/api/v1/group_availability", Respond(ngiAvailability.List)).
+	getSubrouter.HandleFunc("/api/v1/group_availability", Respond(ngiAvailability.List)).Name("group_availability").
 		Queries("group_type", "ngi")
 
+	// Scopes available to the group availability calls
+	getSubrouter.HandleFunc("/api/v1/scopes", Respond(scopes.List)).Name("scopes")
+
 	// Service Flavor Availability
-	getSubrouter.HandleFunc("/api/v1/service_flavor_availability", Respond(serviceFlavorAvailability.List))
+	getSubrouter.HandleFunc("/api/v1/service_flavor_availability", Respond(serviceFlavorAvailability.List)).Name("service_flavor_availability")
 
 	//Availability Profiles
 	postSubrouter.HandleFunc("/api/v1/AP", Respond(availabilityProfiles.Create))
-	getSubrouter.HandleFunc("/api/v1/AP", Respond(availabilityProfiles.List))
+	getSubrouter.HandleFunc("/api/v1/AP", Respond(availabilityProfiles.List)).Name("availability_profiles")
+	getSubrouter.HandleFunc("/api/v1/AP/export", Offer(render.Bundles, availabilityProfiles.Export)).Name("availability_profiles")
+	getSubrouter.HandleFunc("/api/v1/AP/{id}", Respond(availabilityProfiles.ListOne)).Name("availability_profiles")
+	getSubrouter.HandleFunc("/api/v1/AP/{id}/history", Respond(availabilityProfiles.History)).Name("availability_profiles")
+	postSubrouter.HandleFunc("/api/v1/AP/import", Respond(availabilityProfiles.Import))
+	postSubrouter.HandleFunc("/api/v1/AP/{id}/rollback", Respond(availabilityProfiles.Rollback))
 	putSubrouter.HandleFunc("/api/v1/AP/{id}", Respond(availabilityProfiles.Update))
+	patchSubrouter.HandleFunc("/api/v1/AP/{id}", Respond(availabilityProfiles.Patch))
 	deleteSubrouter.HandleFunc("/api/v1/AP/{id}", Respond(availabilityProfiles.Delete))
 
 	//POEM Profiles
-	getSubrouter.HandleFunc("/api/v1/poems", Respond(poemProfiles.List))
+	getSubrouter.HandleFunc("/api/v1/poems", Respond(poemProfiles.List)).Name("poems")
 
 	//Recalculations
 	postSubrouter.HandleFunc("/api/v1/recomputations", Respond(recomputations.Create))
-	getSubrouter.HandleFunc("/api/v1/recomputations", Respond(recomputations.List))
+	getSubrouter.HandleFunc("/api/v1/recomputations", Respond(recomputations.List)).Name("recomputations")
 
-	getSubrouter.HandleFunc("/api/v1/factors", Respond(factors.List))
+	getSubrouter.HandleFunc("/api/v1/factors", Respond(factors.List)).Name("factors")
 
 	//Status
-	getSubrouter.HandleFunc("/api/v1/status/metrics/timeline/{group}", Respond(statusDetail.List))
+	getSubrouter.HandleFunc("/api/v1/status/metrics/timeline/{group}", Respond(statusDetail.List)).Name("status_metrics")
 
 	//Status Raw Msg
-	getSubrouter.HandleFunc("/api/v1/status/metrics/msg/{hostname}/{service}/{metric}", Respond(statusMsg.List))
+	getSubrouter.HandleFunc("/api/v1/status/metrics/msg/{hostname}/{service}/{metric}", Respond(statusMsg.List)).Name("status_msg")
 
 	//Status Endpoints
-	getSubrouter.HandleFunc("/api/v1/status/endpoints/timeline/{group}", Respond(statusEndpoints.List))
+	getSubrouter.HandleFunc("/api/v1/status/endpoints/timeline/{group}", Respond(statusEndpoints.List)).Name("status_endpoints")
 
 	//Status Services
-	getSubrouter.HandleFunc("/api/v1/status/services/timeline/{group}", Respond(statusServices.List))
+	getSubrouter.HandleFunc("/api/v1/status/services/timeline/{group}", Respond(statusServices.List)).Name("status_services")
 
 	//Status Sites
-	getSubrouter.HandleFunc("/api/v1/status/sites/timeline/{group}", Respond(statusSites.List))
+	getSubrouter.HandleFunc("/api/v1/status/sites/timeline/{group}", Respond(statusSites.List)).Name("status_sites")
 
-	http.Handle("/", mainRouter)
+	//Response cache
+	getSubrouter.HandleFunc("/api/v1/cache", Respond(cache.List)).Name("cache")
+	deleteSubrouter.HandleFunc("/api/v1/cache", Respond(cache.Delete))
+
+	//API keys
+	getSubrouter.HandleFunc("/api/v1/keys", Respond(keys.List)).Name("keys")
+	postSubrouter.HandleFunc("/api/v1/keys", Respond(keys.Create))
+	postSubrouter.HandleFunc("/api/v1/keys/{id}/rotate", Respond(keys.Rotate))
+	postSubrouter.HandleFunc("/api/v1/keys/{id}/disable", Respond(keys.Disable))
+	deleteSubrouter.HandleFunc("/api/v1/keys/{id}", Respond(keys.Delete))
 
-	//Cache
-	//get_subrouter.HandleFunc("/api/v1/reset_cache", Respond("text/xml", "utf-8", ResetCache))
+	//Audit log of the requests that modify data
+	getSubrouter.HandleFunc("/api/v1/audit", Respond(audit.List)).Name("audit")
+
+	http.Handle("/", mainRouter)
 
 	//TLS support only
 	config := &tls.Config{
@@ -121,12 +172,48 @@ func main() {
 		},
 		PreferServerCipherSuites: true,
 	}
+
+	//Verify the client certificates that may stand in for an API key
+	if cfg.Authentication.Clientca != "" {
+		pool, err := authentication.ClientCAs(cfg)
+		if err != nil {
+			log.Fatal("Client CA:", err)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = pool
+	}
 	server := &http.Server{Addr: cfg.Server.Bindip + ":" + strconv.Itoa(cfg.Server.Port), Handler: nil, TLSConfig: config}
 	//Web service binds to server. Requests served over HTTPS.
 
+	//Catch a terminate signal, let the requests in flight complete and
+	//release the database connections and profiling data before exiting
+	done := make(chan struct{})
+
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		sig := <-c
+		log.Printf("captured %v, shutting down..", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("requests still in flight after %v: %v", shutdownTimeout, err)
+		}
+		close(done)
+	}()
+
 	err := server.ListenAndServeTLS(cfg.Server.Cert, cfg.Server.Privkey)
 
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatal("ListenAndServe:", err)
 	}
+
+	//ListenAndServeTLS returns as soon as Shutdown starts, the requests in
+	//flight are drained only once Shutdown returns
+	<-done
+
+	mongo.Shutdown()
+	if cfg.Profile != "" {
+		pprof.StopCPUProfile()
+	}
 }
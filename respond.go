@@ -30,8 +30,15 @@ import (
 	"bytes"
 	"compress/gzip"
 	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"github.com/argoeu/argo-web-api/utils/audit"
+	"github.com/argoeu/argo-web-api/utils/caches"
 	"github.com/argoeu/argo-web-api/utils/config"
+	"github.com/argoeu/argo-web-api/utils/render"
+	"github.com/gorilla/mux"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strings"
@@ -43,17 +50,102 @@ const zuluForm = "2006-01-02T15:04:05Z"
 const ymdForm = "20060102"
 
 // The respond function that will be called to answer to http requests to the PI
-func Respond(fn func(r *http.Request, cfg config.Config) (int, http.Header, []byte, error)) http.HandlerFunc {
+func Respond(fn func(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error)) http.HandlerFunc {
+	return Offer(render.Supported(), fn)
+}
+
+// Offer answers http requests in one of the offered media types
+func Offer(offered []string, fn func(r *http.Request, cfg config.Config) (int, http.Header, interface{}, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		code, header, output, err := fn(r, cfg)
+		//Negotiate the media type before handing the request over. Handlers
+		//return their documents, which are rendered into that media type here
+		contentType, err := render.NegotiateFrom(r, offered)
+
+		if err != nil {
+			output := []byte(fmt.Sprintf("%s. Supported media types: %s",
+				http.StatusText(http.StatusNotAcceptable), strings.Join(offered, ", ")))
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write(output)
+			return
+		}
+
+		r = render.WithContentType(r, contentType)
+
+		//Requests that modify data are recorded in the audit collection
+		var entry *audit.Entry
+		var body []byte
+
+		if r.Method != "GET" {
+			body, _ = ioutil.ReadAll(r.Body)
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r, entry = audit.NewRequest(r)
+		}
+
+		code, header, document, err := fn(r, cfg)
+
+		//Documents are rendered once, here, and cached as rendered when the
+		//handler asks for it
+		pending, cache := document.(caches.Pending)
+		if cache {
+			document = pending.Document
+		}
+
+		output, renderErr := render.Output(contentType, document)
+
+		if renderErr != nil {
+			code, err = http.StatusInternalServerError, renderErr
+		}
+
+		if cache && code == http.StatusOK {
+			caches.WriteCache(pending.Name, pending.Input, output, cfg)
+		}
+
+		if entry != nil {
+			if err := audit.Write(cfg, audit.NewRecord(r, routeTemplate(r), body, code, entry)); err != nil {
+				log.Println("Audit:", err)
+			}
+		}
 
 		if code == http.StatusInternalServerError {
 			log.Panic("Internal Server Error:", err)
 		}
 
 		encoding := strings.Split(r.Header.Get("Accept-Encoding"), ",")[0] //get the first accepted encoding
-		if (cfg.Server.Gzip) == true && r.Header.Get("Accept-Encoding") != "" {
+		encoding = strings.TrimSpace(encoding)
+		if cfg.Server.Gzip == false || (encoding != "gzip" && encoding != "deflate") {
+			encoding = ""
+		}
+
+		vary := "Accept"
+		if cfg.Server.Gzip {
+			vary += ", Accept-Encoding"
+		}
+		header.Set("Vary", vary)
+
+		//Successful reads can be revalidated by the clients
+		if r.Method == "GET" && code == http.StatusOK {
+			if header.Get("ETag") == "" { //Handlers may tag what they return themselves
+				header.Set("ETag", etag(output, encoding))
+			}
+			if control := cfg.CacheControl(routeName(r)); control != "" {
+				header.Set("Cache-Control", control)
+			}
+
+			if notModified(r, header) {
+				header.Del("Content-Type")
+				for name, values := range header {
+					for _, value := range values {
+						w.Header().Add(name, value)
+					}
+				}
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		if encoding != "" {
 			var b bytes.Buffer
 			if encoding == "gzip" {
 				writer := gzip.NewWriter(&b)
@@ -71,6 +163,9 @@ func Respond(fn func(r *http.Request, cfg config.Config) (int, http.Header, []by
 		}
 		//Add headers
 
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", render.ContentType(contentType))
+		}
 		header.Set("Content-Length", fmt.Sprintf("%d", len(output)))
 
 		for name, values := range header {
@@ -84,13 +179,56 @@ func Respond(fn func(r *http.Request, cfg config.Config) (int, http.Header, []by
 	}
 }
 
-//Reset the cache if it is set
-func ResetCache(w http.ResponseWriter, r *http.Request) []byte {
-	answer := ""
-	if cfg.Server.Cache == true {
-		httpcache.Clear()
-		answer = "Cache Emptied"
+// etag computes a strong entity tag out of the rendered body. Compressed
+// representations carry the encoding too, since their bytes differ.
+func etag(output []byte, encoding string) string {
+	sum := sha1.Sum(output)
+	tag := hex.EncodeToString(sum[:])
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+	return `"` + tag + `"`
+}
+
+// notModified tells whether the representation the client holds, as given by
+// If-None-Match or, in its absence, If-Modified-Since, is still current
+func notModified(r *http.Request, header http.Header) bool {
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == header.Get("ETag") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// routeName returns the name of the route that matched the request
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		return route.GetName()
+	}
+	return ""
+}
+
+// routeTemplate returns the path template of the route that matched the
+// request e.g. /api/v1/AP/{id}
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ := route.GetPathTemplate()
+		return template
 	}
-	answer = "No Caching is active"
-	return []byte(answer)
+	return ""
 }
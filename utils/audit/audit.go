@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"github.com/argoeu/argo-web-api/utils/mongo"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"time"
+)
+
+// Longest request body kept in a record
+const maxBody = 64 << 10
+
+// A Record describes a request that modified data, as stored in the audit
+// collection
+type Record struct {
+	Actor     string    `bson:"actor"`  // name of the key, certificate or token subject
+	Method    string    `bson:"method"` // how the actor authenticated
+	Verb      string    `bson:"verb"`
+	Resource  string    `bson:"resource"`
+	Route     string    `bson:"route"`
+	Body      string    `bson:"body"`
+	Code      int       `bson:"code"`
+	Timestamp time.Time `bson:"timestamp"`
+	Before    string    `bson:"before,omitempty"` // the document as it was before the request
+	After     string    `bson:"after,omitempty"`  // and as it was left by the request
+}
+
+// An Entry collects what handlers know about the request being audited
+type Entry struct {
+	Actor  string
+	Method string
+	Before interface{}
+	After  interface{}
+}
+
+type contextKey struct{}
+
+// NewRequest returns a copy of r carrying a blank entry for the handlers to
+// fill in
+func NewRequest(r *http.Request) (*http.Request, *Entry) {
+	entry := &Entry{}
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, entry)), entry
+}
+
+// FromRequest returns the entry of an audited request, or nil
+func FromRequest(r *http.Request) *Entry {
+	entry, _ := r.Context().Value(contextKey{}).(*Entry)
+	return entry
+}
+
+// NewRecord completes the entry of a request with its outcome
+func NewRecord(r *http.Request, route string, body []byte, code int, entry *Entry) Record {
+
+	if len(body) > maxBody {
+		body = body[:maxBody]
+	}
+
+	record := Record{
+		Actor:     entry.Actor,
+		Method:    entry.Method,
+		Verb:      r.Method,
+		Resource:  r.URL.Path,
+		Route:     route,
+		Body:      string(body),
+		Code:      code,
+		Timestamp: time.Now().UTC(),
+		Before:    document(entry.Before),
+		After:     document(entry.After),
+	}
+
+	return record
+}
+
+func document(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Write stores a record in the audit collection
+func Write(cfg config.Config, record Record) error {
+
+	session, err := mongo.OpenSession(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
+	query := bson.M{
+		"actor":     record.Actor,
+		"method":    record.Method,
+		"verb":      record.Verb,
+		"resource":  record.Resource,
+		"route":     record.Route,
+		"body":      record.Body,
+		"code":      record.Code,
+		"timestamp": record.Timestamp,
+	}
+
+	if record.Before != "" {
+		query["before"] = record.Before
+	}
+
+	if record.After != "" {
+		query["after"] = record.After
+	}
+
+	return repo.Insert("audit", query)
+}
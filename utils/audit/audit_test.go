@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package audit
+
+import (
+	"github.com/stretchr/testify/suite"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type AuditTestSuite struct {
+	suite.Suite
+}
+
+// TestEntry checks that handlers reach the entry of an audited request only
+func (suite *AuditTestSuite) TestEntry() {
+	request, _ := http.NewRequest("PUT", "/api/v1/AP/5461e2df2e6f6c2a20000001", strings.NewReader(`{"name":"ap1"}`))
+	suite.Nil(FromRequest(request))
+
+	audited, entry := NewRequest(request)
+	suite.True(entry == FromRequest(audited))
+
+	entry.Actor = "operators"
+	entry.Method = "api-key"
+	entry.Before = bson.M{"name": "ap0"}
+	entry.After = bson.M{"name": "ap1"}
+
+	record := NewRecord(audited, "/api/v1/AP/{id}", []byte(`{"name":"ap1"}`), http.StatusOK, entry)
+	suite.Equal("operators", record.Actor)
+	suite.Equal("api-key", record.Method)
+	suite.Equal("PUT", record.Verb)
+	suite.Equal("/api/v1/AP/5461e2df2e6f6c2a20000001", record.Resource)
+	suite.Equal("/api/v1/AP/{id}", record.Route)
+	suite.Equal(`{"name":"ap1"}`, record.Body)
+	suite.Equal(http.StatusOK, record.Code)
+	suite.Equal(`{"name":"ap0"}`, record.Before)
+	suite.Equal(`{"name":"ap1"}`, record.After)
+	suite.False(record.Timestamp.IsZero())
+
+	record = NewRecord(audited, "", make([]byte, maxBody+1), http.StatusUnauthorized, &Entry{})
+	suite.Equal(maxBody, len(record.Body))
+	suite.Equal("", record.Before)
+}
+
+func TestAuditTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditTestSuite))
+}
@@ -27,33 +27,286 @@
 package authentication
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/argoeu/argo-web-api/utils/audit"
 	"github.com/argoeu/argo-web-api/utils/config"
 	"github.com/argoeu/argo-web-api/utils/mongo"
+	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"net/http"
+	"strings"
+	"time"
 )
 
+// Roles that can be granted to an API key
+const (
+	Read                = "read"                 // read the administrative endpoints e.g. the cache statistics
+	ProfilesWrite       = "profiles:write"       // create, update and delete availability profiles
+	RecomputationsWrite = "recomputations:write" // file recomputation requests
+	AuditRead           = "audit:read"           // query the audit log
+	Admin               = "admin"                // implies every other role
+)
+
+// Roles lists every role that can be granted
+var Roles = []string{Read, ProfilesWrite, RecomputationsWrite, AuditRead, Admin}
+
+// LegacyRoles are the roles of the keys stored before roles were introduced,
+// which could change profiles and file recomputations but nothing else
+var LegacyRoles = []string{ProfilesWrite, RecomputationsWrite}
+
+// Auth is an API key as stored in the authentication collection. Keys are
+// handed out in the form id.secret and only a salted hash of the secret is
+// stored. Keys inserted by hand with a plaintext apiKey are hashed in place
+// by MigrateKeys and marked legacy, since they are used without their id.
 type Auth struct {
-	ApiKey string `bson:"apiKey"`
+	Id       bson.ObjectId `bson:"_id"`
+	Legacy   bool          `bson:"legacy"`
+	Salt     string        `bson:"salt"`
+	Hash     string        `bson:"hash"`
+	Name     string        `bson:"name"`
+	Roles    []string      `bson:"roles"`
+	Ngis     []string      `bson:"ngis"`    // NGIs recomputations may be filed for, all when empty
+	Expires  time.Time     `bson:"expires"` // the key never expires when unset
+	Created  time.Time     `bson:"created"`
+	Disabled bool          `bson:"disabled"`
+}
+
+// Identity is the caller of a request as established by its credentials
+type Identity struct {
+	Name   string
+	Method string // api-key, jwt or x509
+	Roles  []string
+	Ngis   []string
+}
+
+// HasRole reports whether the identity was granted role, either directly or
+// through the admin role
+func (id Identity) HasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role || r == Admin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsNgi reports whether the identity may act on behalf of ngi
+func (id Identity) AllowsNgi(ngi string) bool {
+	if len(id.Ngis) == 0 {
+		return true
+	}
+	for _, n := range id.Ngis {
+		if n == ngi {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize identifies the caller of r by its x-api-key header, its bearer
+// token or, failing those, its client certificate and checks that it was
+// granted role. The status is http.StatusUnauthorized when the credentials are
+// missing, unknown or expired, http.StatusForbidden when they lack the role
+// and http.StatusOK otherwise.
+func Authorize(r *http.Request, cfg config.Config, role string) (Identity, int) {
+
+	identity, found := identify(r, cfg)
+
+	//The audit log records who attempted the request
+	if entry := audit.FromRequest(r); entry != nil {
+		entry.Actor = identity.Name
+		entry.Method = identity.Method
+	}
+
+	if !found {
+		return identity, http.StatusUnauthorized
+	}
+
+	if !identity.HasRole(role) {
+		return identity, http.StatusForbidden
+	}
+
+	return identity, http.StatusOK
+}
+
+func identify(r *http.Request, cfg config.Config) (Identity, bool) {
+
+	if key := r.Header.Get("x-api-key"); key != "" {
+		return keyIdentity(key, cfg)
+	}
+
+	if r.Header.Get("Authorization") != "" {
+		return tokenIdentity(r, cfg)
+	}
+
+	return certificateIdentity(r, cfg)
 }
 
-func Authenticate(h http.Header, cfg config.Config) bool {
+func keyIdentity(key string, cfg config.Config) (Identity, bool) {
+
+	identity := Identity{}
 
 	session, err := mongo.OpenSession(cfg)
 
+	if err != nil {
+		return identity, false
+	}
+
+	defer mongo.CloseSession(session)
+
+	repo := mongo.NewRepository(session, cfg)
+
+	id, secret, hashed := splitKey(key)
+
 	query := bson.M{
-		"apiKey": h.Get("x-api-key"),
+		"legacy": true,
+	}
+
+	if hashed {
+		query = bson.M{
+			"_id": bson.ObjectIdHex(id),
+		}
+	} else {
+		//Legacy keys were hashed by MigrateKeys at startup and are used without their id
+		secret = key
 	}
 
 	results := []Auth{}
-	err = mongo.Find(session, cfg.MongoDB.Db, "authentication", query, "apiKey", &results)
+	err = repo.Find("authentication", query, "_id", &results)
 
 	if err != nil {
-		return false
+		return identity, false
 	}
 
-	if len(results) > 0 {
-		return true
+	//Legacy keys carry no id, so every one of them is tried
+	found := false
+	auth := Auth{}
+
+	for _, candidate := range results {
+		if subtle.ConstantTimeCompare([]byte(HashSecret(candidate.Salt, secret)), []byte(candidate.Hash)) == 1 {
+			auth, found = candidate, true
+		}
 	}
-	return false
+
+	if !found || auth.Disabled || (!auth.Expires.IsZero() && time.Now().After(auth.Expires)) {
+		return identity, false
+	}
+
+	identity.Name = auth.Name
+	if identity.Name == "" {
+		identity.Name = auth.Id.Hex()
+	}
+	identity.Method = "api-key"
+	identity.Roles = rolesOf(auth)
+	identity.Ngis = auth.Ngis
+
+	return identity, true
+}
+
+// rolesOf returns the roles of a key. Keys stored before roles were
+// introduced carry no roles field and keep the access they always had.
+func rolesOf(auth Auth) []string {
+	if auth.Roles == nil {
+		return LegacyRoles
+	}
+	return auth.Roles
+}
+
+// MigrateKeys replaces the plaintext apiKey of the keys inserted by hand in
+// the authentication collection with a salted hash, returning how many keys
+// were hashed
+func MigrateKeys(cfg config.Config) (int, error) {
+
+	session, err := mongo.OpenSession(cfg)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer mongo.CloseSession(session)
+
+	return migrateKeys(mongo.NewRepository(session, cfg))
+}
+
+func migrateKeys(repo *mongo.Repository) (int, error) {
+
+	plaintext := []struct {
+		Id     bson.ObjectId `bson:"_id"`
+		ApiKey string        `bson:"apiKey"`
+	}{}
+
+	err := repo.Find("authentication", bson.M{"apiKey": bson.M{"$exists": true}}, "_id", &plaintext)
+
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+
+	for _, key := range plaintext {
+
+		salt, err := newSalt()
+
+		if err != nil {
+			return migrated, err
+		}
+
+		update := bson.M{
+			"$set":   bson.M{"salt": salt, "hash": HashSecret(salt, key.ApiKey), "legacy": true},
+			"$unset": bson.M{"apiKey": ""},
+		}
+
+		//A key hashed meanwhile by another request is left alone
+		err = repo.C("authentication").Update(bson.M{"_id": key.Id, "apiKey": key.ApiKey}, update)
+
+		if err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return migrated, err
+		}
+
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// NewSecret generates the secret of a key along with the salt and hash that
+// are stored in its place
+func NewSecret() (secret string, salt string, hash string, err error) {
+
+	random := make([]byte, 48)
+
+	if _, err = rand.Read(random); err != nil {
+		return "", "", "", err
+	}
+
+	secret = hex.EncodeToString(random[:32])
+	salt = hex.EncodeToString(random[32:])
+	return secret, salt, HashSecret(salt, secret), nil
+}
+
+func newSalt() (string, error) {
+	random := make([]byte, 16)
+	_, err := rand.Read(random)
+	return hex.EncodeToString(random), err
+}
+
+// HashSecret returns the hex encoded SHA-256 hash of the salted secret
+func HashSecret(salt string, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitKey splits a key of the form id.secret, reporting false for the
+// legacy keys that are used without their id
+func splitKey(key string) (string, string, bool) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 || !bson.IsObjectIdHex(parts[0]) || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
 }
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package authentication
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type AuthenticationTestSuite struct {
+	suite.Suite
+}
+
+// TestHasRole checks that roles are granted directly or through admin
+func (suite *AuthenticationTestSuite) TestHasRole() {
+	identity := Identity{Roles: []string{ProfilesWrite}}
+	suite.True(identity.HasRole(ProfilesWrite))
+	suite.False(identity.HasRole(RecomputationsWrite))
+	suite.False(identity.HasRole(Admin))
+
+	admin := Identity{Roles: []string{Admin}}
+	suite.True(admin.HasRole(RecomputationsWrite))
+	suite.True(admin.HasRole(Read))
+
+	suite.False(Identity{}.HasRole(Read))
+}
+
+// TestLegacyRoles checks that keys stored before roles were introduced
+// keep only the roles they needed back then
+func (suite *AuthenticationTestSuite) TestLegacyRoles() {
+	legacy := Identity{Roles: rolesOf(Auth{})}
+	suite.True(legacy.HasRole(ProfilesWrite))
+	suite.True(legacy.HasRole(RecomputationsWrite))
+	suite.False(legacy.HasRole(Admin))
+	suite.False(legacy.HasRole(AuditRead))
+	suite.False(legacy.HasRole(Read))
+
+	suite.Equal([]string{}, rolesOf(Auth{Roles: []string{}}))
+	suite.Equal([]string{Admin}, rolesOf(Auth{Roles: []string{Admin}}))
+}
+
+// TestAllowsNgi checks the NGI restriction of the recomputation requests
+func (suite *AuthenticationTestSuite) TestAllowsNgi() {
+	suite.True(Identity{}.AllowsNgi("NGI_GRNET"))
+
+	identity := Identity{Ngis: []string{"NGI_GRNET", "NGI_HR"}}
+	suite.True(identity.AllowsNgi("NGI_HR"))
+	suite.False(identity.AllowsNgi("NGI_FRANCE"))
+	suite.False(identity.AllowsNgi(""))
+}
+
+// TestSecrets checks that generated secrets verify against their stored hash
+func (suite *AuthenticationTestSuite) TestSecrets() {
+	secret, salt, hash, err := NewSecret()
+	suite.Nil(err)
+	suite.Equal(64, len(secret))
+	suite.Equal(hash, HashSecret(salt, secret))
+	suite.NotEqual(hash, HashSecret(salt, secret+"0"))
+
+	other, otherSalt, _, _ := NewSecret()
+	suite.NotEqual(secret, other)
+	suite.NotEqual(salt, otherSalt)
+}
+
+// TestSplitKey checks that plaintext keys are told apart from id.secret keys
+func (suite *AuthenticationTestSuite) TestSplitKey() {
+	id, secret, hashed := splitKey("5461e2df2e6f6c2a20000001.c0ffee")
+	suite.True(hashed)
+	suite.Equal("5461e2df2e6f6c2a20000001", id)
+	suite.Equal("c0ffee", secret)
+
+	for _, key := range []string{"S3CR3T", "S3CR3T.c0ffee", "5461e2df2e6f6c2a20000001.", ""} {
+		_, _, hashed = splitKey(key)
+		suite.False(hashed, key)
+	}
+}
+
+// TestCertificateIdentity checks that verified client certificates are mapped
+// to roles by their grid style subject DN
+func (suite *AuthenticationTestSuite) TestCertificateIdentity() {
+	dc := asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}
+	subject, _ := asn1.Marshal(pkix.RDNSequence{
+		{{Type: dc, Value: "org"}},
+		{{Type: dc, Value: "terena"}},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 6}, Value: "GR"}},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: "GRNET"}},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "John Doe"}},
+	})
+	certificate := &x509.Certificate{RawSubject: subject}
+	dn := "/DC=org/DC=terena/C=GR/O=GRNET/CN=John Doe"
+	suite.Equal(dn, DistinguishedName(certificate))
+
+	cfg := config.Config{}
+	cfg.Certificate = map[string]*config.Certificate{
+		dn: {Role: []string{RecomputationsWrite}, Ngi: []string{"NGI_GRNET"}},
+	}
+
+	request, _ := http.NewRequest("POST", "/api/v1/recomputations", nil)
+	_, found := certificateIdentity(request, cfg)
+	suite.False(found)
+
+	request.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{certificate}},
+	}
+	identity, found := certificateIdentity(request, cfg)
+	suite.True(found)
+	suite.Equal(Identity{Name: dn, Method: "x509", Roles: []string{RecomputationsWrite}, Ngis: []string{"NGI_GRNET"}}, identity)
+
+	_, code := Authorize(request, cfg, ProfilesWrite)
+	suite.Equal(http.StatusForbidden, code)
+
+	delete(cfg.Certificate, dn)
+	_, code = Authorize(request, cfg, RecomputationsWrite)
+	suite.Equal(http.StatusUnauthorized, code)
+}
+
+func TestAuthenticationTestSuite(t *testing.T) {
+	suite.Run(t, new(AuthenticationTestSuite))
+}
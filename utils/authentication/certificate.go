@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package authentication
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"io/ioutil"
+	"net/http"
+)
+
+// Short names of the attributes of a distinguished name, as printed by openssl
+var attributeNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "street",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.17":                   "postalCode",
+	"0.9.2342.19200300.100.1.1":  "UID",
+	"0.9.2342.19200300.100.1.25": "DC",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+}
+
+// ClientCAs loads the CA bundle that verifies the client certificates
+func ClientCAs(cfg config.Config) (*x509.CertPool, error) {
+
+	pem, err := ioutil.ReadFile(cfg.Authentication.Clientca)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + cfg.Authentication.Clientca)
+	}
+
+	return pool, nil
+}
+
+// DistinguishedName formats the subject of a certificate the way grid
+// middleware does e.g. /DC=org/DC=terena/DC=tcs/C=GR/O=GRNET/CN=John Doe,
+// keeping the attributes in the order they were encoded in
+func DistinguishedName(cert *x509.Certificate) string {
+
+	var subject pkix.RDNSequence
+
+	if rest, err := asn1.Unmarshal(cert.RawSubject, &subject); err != nil || len(rest) > 0 {
+		subject = cert.Subject.ToRDNSequence()
+	}
+
+	dn := ""
+
+	for _, rdn := range subject {
+		for _, attribute := range rdn {
+			short, found := attributeNames[attribute.Type.String()]
+			if !found {
+				short = attribute.Type.String()
+			}
+			dn += "/" + short + "=" + attributeValue(attribute)
+		}
+	}
+
+	return dn
+}
+
+func attributeValue(attribute pkix.AttributeTypeAndValue) string {
+	if value, ok := attribute.Value.(string); ok {
+		return value
+	}
+	if raw, err := asn1.Marshal(attribute.Value); err == nil {
+		return fmt.Sprintf("#%x", raw)
+	}
+	return fmt.Sprint(attribute.Value)
+}
+
+// certificateIdentity identifies the caller of r by the client certificate it
+// presented, which the TLS handshake has already verified against the
+// configured CA bundle. Only the certificates of the [certificate] sections
+// are accepted.
+func certificateIdentity(r *http.Request, cfg config.Config) (Identity, bool) {
+
+	identity := Identity{}
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return identity, false
+	}
+
+	dn := DistinguishedName(r.TLS.VerifiedChains[0][0])
+	certificate, found := cfg.Certificate[dn]
+
+	if !found || certificate == nil {
+		return identity, false
+	}
+
+	identity.Name = certificate.Name
+	if identity.Name == "" {
+		identity.Name = dn
+	}
+	identity.Method = "x509"
+	identity.Roles = certificate.Role
+	identity.Ngis = certificate.Ngi
+
+	return identity, true
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package authentication
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clock skew tolerated when checking the validity period of a token
+const tokenLeeway = time.Minute
+
+var errInvalidToken = errors.New("invalid token")
+
+// The keys of the JSON Web Key Set, reloaded whenever the file changes
+var keySet = struct {
+	sync.Mutex
+	path     string
+	modified time.Time
+	keys     map[string]*rsa.PublicKey
+}{}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// signingKeys returns the RSA signing keys of the configured JWKS file by id
+func signingKeys(path string) (map[string]*rsa.PublicKey, error) {
+
+	keySet.Lock()
+	defer keySet.Unlock()
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if keySet.path == path && keySet.modified.Equal(info.ModTime()) {
+		return keySet.keys, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	document := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	if err = json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+
+	for _, key := range document.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	keySet.path = path
+	keySet.modified = info.ModTime()
+	keySet.keys = keys
+
+	return keys, nil
+}
+
+// verifyToken checks the RS256 signature, issuer, audience and validity
+// period of a JWT and returns its claims
+func verifyToken(token string, cfg config.Config, now time.Time) (map[string]interface{}, error) {
+
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+
+	header := tokenHeader{}
+
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return nil, errInvalidToken
+	}
+
+	keys, err := signingKeys(cfg.Oidc.Jwks)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, found := keys[header.Kid]
+
+	if !found {
+		return nil, errInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+		return nil, errInvalidToken
+	}
+
+	claims := map[string]interface{}{}
+
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, errInvalidToken
+	}
+
+	if issuer, _ := claims["iss"].(string); issuer != cfg.Oidc.Issuer {
+		return nil, errInvalidToken
+	}
+
+	if cfg.Oidc.Audience != "" && !contains(claimValues(claims["aud"]), cfg.Oidc.Audience) {
+		return nil, errInvalidToken
+	}
+
+	expires, ok := claims["exp"].(float64)
+
+	if !ok || now.After(time.Unix(int64(expires), 0).Add(tokenLeeway)) {
+		return nil, errInvalidToken
+	}
+
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(tokenLeeway).Before(time.Unix(int64(notBefore), 0)) {
+		return nil, errInvalidToken
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// claimValues returns the values of a claim that holds either a string or an
+// array of strings
+func claimValues(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenIdentity identifies the caller of r by the bearer token of its
+// Authorization header. The roles are granted by the [claim] sections that
+// match the values of the configured claim.
+func tokenIdentity(r *http.Request, cfg config.Config) (Identity, bool) {
+
+	identity := Identity{}
+	authorization := r.Header.Get("Authorization")
+
+	if cfg.Oidc.Issuer == "" || !strings.HasPrefix(authorization, "Bearer ") {
+		return identity, false
+	}
+
+	claims, err := verifyToken(strings.TrimSpace(authorization[len("Bearer "):]), cfg, time.Now())
+
+	if err != nil {
+		return identity, false
+	}
+
+	identity.Name, _ = claims["sub"].(string)
+	identity.Method = "jwt"
+
+	unrestricted := false
+
+	for _, value := range claimValues(claims[cfg.Oidc.Claim]) {
+		grant, found := cfg.Claim[value]
+		if !found || grant == nil {
+			continue
+		}
+		identity.Roles = append(identity.Roles, grant.Role...)
+		//NGIs only restrict the grants that may file recomputations
+		if !contains(grant.Role, RecomputationsWrite) && !contains(grant.Role, Admin) {
+			continue
+		}
+		identity.Ngis = append(identity.Ngis, grant.Ngi...)
+		unrestricted = unrestricted || len(grant.Ngi) == 0
+	}
+
+	//A recomputations grant without NGIs lifts the restriction of the others
+	if unrestricted {
+		identity.Ngis = nil
+	}
+
+	return identity, true
+}
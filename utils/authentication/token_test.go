@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package authentication
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/argoeu/argo-web-api/utils/config"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type TokenTestSuite struct {
+	suite.Suite
+	key *rsa.PrivateKey
+	dir string
+	cfg config.Config
+}
+
+func (suite *TokenTestSuite) SetupTest() {
+	suite.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	suite.dir, _ = ioutil.TempDir("", "jwks")
+
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(suite.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(suite.key.E)).Bytes()),
+		}},
+	})
+	path := filepath.Join(suite.dir, "jwks.json")
+	_ = ioutil.WriteFile(path, jwks, 0600)
+
+	suite.cfg = config.Config{}
+	suite.cfg.Oidc.Issuer = "https://aai.example.org/oidc/"
+	suite.cfg.Oidc.Jwks = path
+	suite.cfg.Oidc.Audience = "argo-web-api"
+	suite.cfg.Oidc.Claim = "eduperson_entitlement"
+	suite.cfg.Claim = map[string]*config.Certificate{
+		"urn:mace:example.org:group:ops:role=manager": {Role: []string{RecomputationsWrite}, Ngi: []string{"NGI_GRNET"}},
+	}
+}
+
+func (suite *TokenTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+// sign issues a token for claims signed with the key of the test JWKS
+func (suite *TokenTestSuite) sign(kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, suite.key, crypto.SHA256, digest[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (suite *TokenTestSuite) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":                   suite.cfg.Oidc.Issuer,
+		"aud":                   []string{"portal", "argo-web-api"},
+		"sub":                   "jdoe@example.org",
+		"exp":                   time.Now().Add(time.Hour).Unix(),
+		"eduperson_entitlement": []string{"urn:mace:example.org:group:ops:role=manager", "urn:other"},
+	}
+}
+
+func (suite *TokenTestSuite) request(token string) *http.Request {
+	request, _ := http.NewRequest("POST", "/api/v1/recomputations", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	return request
+}
+
+// TestValidToken checks that the roles of a valid token come from its claims
+func (suite *TokenTestSuite) TestValidToken() {
+	request := suite.request(suite.sign("test", suite.claims()))
+
+	identity, code := Authorize(request, suite.cfg, RecomputationsWrite)
+	suite.Equal(http.StatusOK, code)
+	suite.Equal(Identity{Name: "jdoe@example.org", Method: "jwt", Roles: []string{RecomputationsWrite}, Ngis: []string{"NGI_GRNET"}}, identity)
+
+	_, code = Authorize(request, suite.cfg, ProfilesWrite)
+	suite.Equal(http.StatusForbidden, code)
+}
+
+// TestMixedGrants checks that a grant without NGIs only lifts the NGI
+// restriction of the others when it may file recomputations itself
+func (suite *TokenTestSuite) TestMixedGrants() {
+	suite.cfg.Claim["urn:mace:example.org:group:ops:role=editor"] = &config.Certificate{Role: []string{ProfilesWrite}}
+	suite.cfg.Claim["urn:mace:example.org:group:ops:role=admin"] = &config.Certificate{Role: []string{Admin}}
+
+	claims := suite.claims()
+	claims["eduperson_entitlement"] = []string{"urn:mace:example.org:group:ops:role=editor", "urn:mace:example.org:group:ops:role=manager"}
+	identity, code := Authorize(suite.request(suite.sign("test", claims)), suite.cfg, RecomputationsWrite)
+	suite.Equal(http.StatusOK, code)
+	suite.Equal([]string{ProfilesWrite, RecomputationsWrite}, identity.Roles)
+	suite.Equal([]string{"NGI_GRNET"}, identity.Ngis)
+	suite.False(identity.AllowsNgi("NGI_IT"))
+
+	claims["eduperson_entitlement"] = []string{"urn:mace:example.org:group:ops:role=admin", "urn:mace:example.org:group:ops:role=manager"}
+	identity, code = Authorize(suite.request(suite.sign("test", claims)), suite.cfg, RecomputationsWrite)
+	suite.Equal(http.StatusOK, code)
+	suite.Nil(identity.Ngis)
+	suite.True(identity.AllowsNgi("NGI_IT"))
+}
+
+// TestInvalidTokens checks that tokens failing any check are refused
+func (suite *TokenTestSuite) TestInvalidTokens() {
+	tokens := map[string]string{}
+
+	tokens["unknown key"] = suite.sign("other", suite.claims())
+
+	claims := suite.claims()
+	claims["iss"] = "https://evil.example.org/"
+	tokens["issuer"] = suite.sign("test", claims)
+
+	claims = suite.claims()
+	claims["aud"] = "portal"
+	tokens["audience"] = suite.sign("test", claims)
+
+	claims = suite.claims()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	tokens["expired"] = suite.sign("test", claims)
+
+	claims = suite.claims()
+	delete(claims, "exp")
+	tokens["no expiry"] = suite.sign("test", claims)
+
+	parts := strings.Split(suite.sign("test", suite.claims()), ".")
+	forged, _ := json.Marshal(map[string]interface{}{"iss": suite.cfg.Oidc.Issuer, "sub": "admin", "exp": time.Now().Add(time.Hour).Unix()})
+	tokens["tampered"] = parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2]
+
+	tokens["malformed"] = "not.a.token"
+
+	for name, token := range tokens {
+		_, code := Authorize(suite.request(token), suite.cfg, RecomputationsWrite)
+		suite.Equal(http.StatusUnauthorized, code, name)
+	}
+}
+
+func TestTokenTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenTestSuite))
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package caches
+
+import (
+	"github.com/argoeu/go-lru-cache"
+	"time"
+)
+
+// A Backend stores the cached responses. Every entry expires after the TTL
+// it was stored with.
+type Backend interface {
+	// Get returns the response stored under key and the time it was stored
+	Get(key string) (output []byte, stored time.Time, found bool, err error)
+	Set(key string, output []byte, stored time.Time, ttl time.Duration) error
+	// Delete removes the given keys and returns how many of them existed
+	Delete(keys ...string) (int, error)
+	// Clear removes every entry and returns how many there were
+	Clear() (int, error)
+	Keys() ([]string, error)
+	// Stats returns the number of entries, their size in bytes and the
+	// capacity of the backend, where known
+	Stats() (length uint64, size uint64, capacity uint64, err error)
+}
+
+// lruBackend keeps the responses in the memory of the process
+type lruBackend struct {
+	lru *cache.LRUCache
+}
+
+type entry struct {
+	output  []byte
+	stored  time.Time
+	expires time.Time
+}
+
+func (e *entry) Size() int {
+	return len(e.output)
+}
+
+func NewLRUBackend(capacity uint64) Backend {
+	return &lruBackend{lru: cache.NewLRUCache(capacity)}
+}
+
+func (b *lruBackend) Get(key string) ([]byte, time.Time, bool, error) {
+	value, ok := b.lru.Get(key)
+	if !ok {
+		return nil, time.Time{}, false, nil
+	}
+
+	e := value.(*entry)
+	if !time.Now().Before(e.expires) {
+		b.lru.Delete(key)
+		return nil, time.Time{}, false, nil
+	}
+
+	return e.output, e.stored, true, nil
+}
+
+func (b *lruBackend) Set(key string, output []byte, stored time.Time, ttl time.Duration) error {
+	b.lru.Set(key, &entry{output: output, stored: stored, expires: stored.Add(ttl)})
+	return nil
+}
+
+func (b *lruBackend) Delete(keys ...string) (int, error) {
+	deleted := 0
+	for _, key := range keys {
+		if b.lru.Delete(key) {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (b *lruBackend) Clear() (int, error) {
+	length, _, _, _ := b.lru.Stats()
+	b.lru.Clear()
+	return int(length), nil
+}
+
+func (b *lruBackend) Keys() ([]string, error) {
+	return b.lru.Keys(), nil
+}
+
+func (b *lruBackend) Stats() (uint64, uint64, uint64, error) {
+	length, size, capacity, _ := b.lru.Stats()
+	return length, size, capacity, nil
+}
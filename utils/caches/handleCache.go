@@ -29,33 +29,225 @@ package caches
 import (
 	"fmt"
 	"github.com/argoeu/argo-web-api/utils/config"
-	"github.com/argoeu/go-lru-cache"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
-var httpcache *cache.LRUCache
+// The regions whose responses depend on the availability profiles and the
+// recomputations and are purged whenever those change
+var Availability = []string{"sites", "ngis", "vos", "sf"}
 
-type mystring string
+// The responses of every call are stored in one process wide backend,
+// selected by the cachebackend setting of the [server] section.
+// Keys are prefixed by the region of the call, e.g. "sites|{...}"
+var backend Backend
+var once sync.Once
 
-func (s mystring) Size() int {
-	return len(s)
+var statsLock sync.Mutex
+var hits = map[string]uint64{}
+var misses = map[string]uint64{}
+
+// RegionStats holds the counters of a region of the cache
+type RegionStats struct {
+	Name    string
+	Entries int
+	Hits    uint64
+	Misses  uint64
+	TTL     time.Duration
+}
+
+// Stats describes the state of the cache. Hits and misses are counted by
+// each replica of the API, the entries are those of the shared backend.
+type Stats struct {
+	Enabled  bool
+	Backend  string
+	Length   uint64
+	Size     uint64
+	Capacity uint64
+	Regions  []RegionStats
+}
+
+func open(cfg config.Config) Backend {
+	once.Do(func() {
+		switch strings.ToLower(cfg.Server.Cachebackend) {
+		case "redis", "resp":
+			backend = NewRESPBackend(cfg.Server.Redisaddr, cfg.Server.Redispassword, cfg.Server.Redisdb, cfg.Server.Redisprefix)
+		default:
+			backend = NewLRUBackend(uint64(cfg.Server.Lrucache))
+		}
+	})
+	return backend
+}
+
+// key derives the cache key of a call out of its region and its normalized
+// input, which includes the negotiated media type of the response
+func key(name string, input interface{}) string {
+	return name + "|" + fmt.Sprintf("%+v", input)
 }
 
 func HitCache(name string, input interface{}, cfg config.Config) (bool, []byte) {
+	found, output, _ := Lookup(name, input, cfg)
+	return found, output
+}
+
+// Lookup returns the cached response of a call along with the time it was
+// stored, which is the time it was last modified as far as clients are concerned
+func Lookup(name string, input interface{}, cfg config.Config) (bool, []byte, time.Time) {
 	output := []byte(nil)
+	stored := time.Time{}
 	found := false
+
 	if cfg.Server.Cache == true {
-		out, found := httpcache.Get(name + fmt.Sprint(input))
-		if found {
-			output = []byte(fmt.Sprint(out))
+		var err error
+		output, stored, found, err = open(cfg).Get(key(name, input))
+
+		// An unreachable backend is a cache miss, the response is computed instead
+		if err != nil {
+			log.Println("Cache:", err)
 		}
+
+		count(name, found)
 	}
-	return found, output
+
+	return found, output, stored
 }
 
-func WriteCache(name string, input interface{}, output interface{}, cfg config.Config) bool {
+// A Pending response is rendered by the caller of the handler that returned
+// it and then written to the cache under the region and the input of the call
+type Pending struct {
+	Name     string
+	Input    interface{}
+	Document interface{}
+}
+
+func WriteCache(name string, input interface{}, output []byte, cfg config.Config) bool {
 
 	if cfg.Server.Cache == true {
-		httpcache.Set(name+fmt.Sprint(input), output.(mystring))
+		err := open(cfg).Set(key(name, input), output, time.Now(), cfg.CacheTTL(name))
+
+		if err != nil {
+			log.Println("Cache:", err)
+			return false
+		}
 	}
 	return true
 }
+
+// Purge removes the entries of the given regions, or all of them when no
+// region is given, and returns the number of entries removed
+func Purge(cfg config.Config, regions ...string) int {
+
+	if cfg.Server.Cache == false {
+		return 0
+	}
+
+	c := open(cfg)
+
+	if len(regions) == 0 {
+		purged, err := c.Clear()
+		if err != nil {
+			log.Println("Cache:", err)
+		}
+		return purged
+	}
+
+	keys, err := c.Keys()
+	if err != nil {
+		log.Println("Cache:", err)
+		return 0
+	}
+
+	matching := []string{}
+	for _, k := range keys {
+		for _, region := range regions {
+			if strings.HasPrefix(k, region+"|") {
+				matching = append(matching, k)
+				break
+			}
+		}
+	}
+
+	purged, err := c.Delete(matching...)
+	if err != nil {
+		log.Println("Cache:", err)
+	}
+	return purged
+}
+
+// Statistics reports the usage of the cache and the hits and misses of each region
+func Statistics(cfg config.Config) Stats {
+
+	stats := Stats{Enabled: cfg.Server.Cache}
+
+	if cfg.Server.Cache == false {
+		return stats
+	}
+
+	c := open(cfg)
+	stats.Backend = strings.ToLower(cfg.Server.Cachebackend)
+	if stats.Backend == "" {
+		stats.Backend = "lru"
+	}
+
+	var err error
+	stats.Length, stats.Size, stats.Capacity, err = c.Stats()
+	if err != nil {
+		log.Println("Cache:", err)
+	}
+
+	keys, err := c.Keys()
+	if err != nil {
+		log.Println("Cache:", err)
+	}
+
+	entries := map[string]int{}
+	for _, k := range keys {
+		entries[strings.SplitN(k, "|", 2)[0]]++
+	}
+
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	seen := map[string]bool{}
+	for name := range entries {
+		seen[name] = true
+	}
+	for name := range hits {
+		seen[name] = true
+	}
+	for name := range misses {
+		seen[name] = true
+	}
+
+	names := []string{}
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		stats.Regions = append(stats.Regions, RegionStats{
+			Name:    name,
+			Entries: entries[name],
+			Hits:    hits[name],
+			Misses:  misses[name],
+			TTL:     cfg.CacheTTL(name),
+		})
+	}
+
+	return stats
+}
+
+func count(name string, hit bool) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	if hit {
+		hits[name]++
+	} else {
+		misses[name]++
+	}
+}
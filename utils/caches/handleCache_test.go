@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package caches
+
+import (
+	"github.com/argoeu/argo-web-api/utils/config"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type CachesTestSuite struct {
+	suite.Suite
+	cfg config.Config
+}
+
+type testInput struct {
+	group  string
+	format string
+}
+
+func (suite *CachesTestSuite) SetupTest() {
+	suite.cfg = config.Config{}
+	suite.cfg.Server.Cache = true
+	suite.cfg.Server.Lrucache = 1000000
+	suite.cfg.Cache.Ttl = 60
+	suite.cfg.Cache.Region = []string{"status_sites:0"}
+	Purge(suite.cfg)
+}
+
+// TestHitCache checks that responses are found by region and input
+func (suite *CachesTestSuite) TestHitCache() {
+	input := testInput{"GRNET", "application/xml"}
+
+	found, _ := HitCache("sites", input, suite.cfg)
+	suite.False(found)
+
+	WriteCache("sites", input, []byte("<root/>"), suite.cfg)
+
+	found, output := HitCache("sites", input, suite.cfg)
+	suite.True(found)
+	suite.Equal("<root/>", string(output))
+
+	// The negotiated media type is part of the key
+	found, _ = HitCache("sites", testInput{"GRNET", "application/json"}, suite.cfg)
+	suite.False(found)
+
+	found, _ = HitCache("ngis", input, suite.cfg)
+	suite.False(found)
+
+	// Entries of a region with a zero TTL expire at once
+	WriteCache("status_sites", input, []byte("<root/>"), suite.cfg)
+	found, _ = HitCache("status_sites", input, suite.cfg)
+	suite.False(found)
+
+	cfg := suite.cfg
+	cfg.Server.Cache = false
+	found, _ = HitCache("sites", input, cfg)
+	suite.False(found)
+}
+
+// TestPurge checks that purging removes the entries of the given regions only
+func (suite *CachesTestSuite) TestPurge() {
+	input := testInput{"GRNET", "application/xml"}
+
+	WriteCache("sites", input, []byte("sites"), suite.cfg)
+	WriteCache("vos", input, []byte("vos"), suite.cfg)
+	WriteCache("status_metrics", input, []byte("metrics"), suite.cfg)
+
+	suite.Equal(2, Purge(suite.cfg, Availability...))
+
+	found, _ := HitCache("sites", input, suite.cfg)
+	suite.False(found)
+	found, _ = HitCache("status_metrics", input, suite.cfg)
+	suite.True(found)
+
+	stats := Statistics(suite.cfg)
+	suite.True(stats.Enabled)
+	suite.Equal(uint64(1), stats.Length)
+
+	suite.Equal(1, Purge(suite.cfg))
+	found, _ = HitCache("status_metrics", input, suite.cfg)
+	suite.False(found)
+}
+
+func TestCachesTestSuite(t *testing.T) {
+	suite.Run(t, new(CachesTestSuite))
+}
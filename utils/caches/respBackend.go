@@ -0,0 +1,313 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package caches
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// respBackend keeps the responses in a Redis compatible server, speaking the
+// RESP protocol, so that every replica of the API shares the same entries.
+// Keys are namespaced by prefix so that the server can be shared.
+type respBackend struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+	pool     chan *respConn
+}
+
+type respConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// The number of idle connections kept open to the server
+const respPoolSize = 16
+
+func NewRESPBackend(addr string, password string, db int, prefix string) Backend {
+	return &respBackend{
+		addr:     addr,
+		password: password,
+		db:       db,
+		prefix:   prefix,
+		timeout:  5 * time.Second,
+		pool:     make(chan *respConn, respPoolSize),
+	}
+}
+
+// Values are stored as the time they were stored, in unix nanoseconds,
+// followed by a space and the response
+func (b *respBackend) Get(key string) ([]byte, time.Time, bool, error) {
+	reply, err := b.do("GET", b.prefix+key)
+	if err != nil || reply == nil {
+		return nil, time.Time{}, false, err
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, time.Time{}, false, errors.New("unexpected reply to GET")
+	}
+
+	i := bytes.IndexByte(value, ' ')
+	if i < 0 {
+		return nil, time.Time{}, false, errors.New("malformed cache entry " + key)
+	}
+	nanos, err := strconv.ParseInt(string(value[:i]), 10, 64)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	return value[i+1:], time.Unix(0, nanos), true, nil
+}
+
+func (b *respBackend) Set(key string, output []byte, stored time.Time, ttl time.Duration) error {
+	millis := int64(ttl / time.Millisecond)
+	if millis <= 0 {
+		// Redis refuses non positive expiration times, the entry has expired already
+		_, err := b.Delete(key)
+		return err
+	}
+
+	value := append([]byte(strconv.FormatInt(stored.UnixNano(), 10)+" "), output...)
+	_, err := b.do("SET", b.prefix+key, value, "PX", strconv.FormatInt(millis, 10))
+	return err
+}
+
+func (b *respBackend) Delete(keys ...string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	args := []interface{}{"DEL"}
+	for _, key := range keys {
+		args = append(args, b.prefix+key)
+	}
+
+	reply, err := b.do(args...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return int(n), nil
+}
+
+func (b *respBackend) Clear() (int, error) {
+	keys, err := b.Keys()
+	if err != nil {
+		return 0, err
+	}
+	return b.Delete(keys...)
+}
+
+// Keys lists the entries of the prefix with SCAN, which unlike KEYS does not
+// block the server while it iterates
+func (b *respBackend) Keys() ([]string, error) {
+	keys := []string{}
+	cursor := "0"
+
+	for {
+		reply, err := b.do("SCAN", cursor, "MATCH", b.prefix+"*", "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return nil, errors.New("unexpected reply to SCAN")
+		}
+
+		next, _ := page[0].([]byte)
+		found, _ := page[1].([]interface{})
+		for _, key := range found {
+			if k, ok := key.([]byte); ok {
+				keys = append(keys, strings.TrimPrefix(string(k), b.prefix))
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// Stats only reports the number of entries, the size and capacity of the
+// server are not tracked per prefix
+func (b *respBackend) Stats() (uint64, uint64, uint64, error) {
+	keys, err := b.Keys()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return uint64(len(keys)), 0, 0, nil
+}
+
+// do sends a command over a pooled connection and reads its reply. A
+// connection that failed is closed instead of being returned to the pool.
+func (b *respBackend) do(args ...interface{}) (interface{}, error) {
+	c, err := b.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(b.timeout, args...)
+	if err != nil {
+		if _, ok := err.(respError); !ok {
+			c.conn.Close()
+			return nil, err
+		}
+	}
+
+	b.put(c)
+	return reply, err
+}
+
+func (b *respBackend) get() (*respConn, error) {
+	select {
+	case c := <-b.pool:
+		return c, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", b.addr, b.timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &respConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if b.password != "" {
+		if _, err = c.do(b.timeout, "AUTH", b.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if b.db != 0 {
+		if _, err = c.do(b.timeout, "SELECT", strconv.Itoa(b.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (b *respBackend) put(c *respConn) {
+	select {
+	case b.pool <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+// respError is an error reply of the server, after which the connection
+// can still be used
+type respError string
+
+func (e respError) Error() string {
+	return string(e)
+}
+
+func (c *respConn) do(timeout time.Duration, args ...interface{}) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(timeout))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var value []byte
+		switch a := arg.(type) {
+		case []byte:
+			value = a
+		default:
+			value = []byte(fmt.Sprint(a))
+		}
+		fmt.Fprintf(&buf, "$%d\r\n", len(value))
+		buf.Write(value)
+		buf.WriteString("\r\n")
+	}
+
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return readReply(c.reader)
+}
+
+// readReply parses a RESP reply: simple strings and bulk strings are returned
+// as []byte, integers as int64, arrays as []interface{} and nil bulk strings
+// and arrays as nil
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.New("malformed RESP reply")
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return []byte(payload), nil
+	case '-':
+		return nil, respError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		value := make([]byte, n+2)
+		if _, err = io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+
+	return nil, errors.New("unknown RESP reply type " + string(kind))
+}
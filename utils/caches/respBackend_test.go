@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package caches
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRESP is an in-process server speaking enough of the RESP protocol
+// (AUTH, GET, SET with PX, DEL and SCAN) to exercise the RESP backend
+type fakeRESP struct {
+	listener net.Listener
+	password string
+	lock     sync.Mutex
+	values   map[string]string
+	expires  map[string]time.Time
+}
+
+func newFakeRESP(password string) *fakeRESP {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	f := &fakeRESP{listener: listener, password: password, values: map[string]string{}, expires: map[string]time.Time{}}
+	go f.serve()
+	return f
+}
+
+func (f *fakeRESP) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRESP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+
+	for {
+		request, err := readReply(r)
+		if err != nil {
+			return
+		}
+		args := []string{}
+		for _, arg := range request.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		if strings.ToUpper(args[0]) == "AUTH" {
+			authenticated = args[1] == f.password
+		}
+		if !authenticated {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+
+		f.lock.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "GET":
+			value, ok := f.values[args[1]]
+			if ok && time.Now().Before(f.expires[args[1]]) {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case "SET":
+			millis, _ := strconv.Atoi(args[4])
+			f.values[args[1]] = args[2]
+			f.expires[args[1]] = time.Now().Add(time.Duration(millis) * time.Millisecond)
+			fmt.Fprint(conn, "+OK\r\n")
+		case "DEL":
+			n := 0
+			for _, k := range args[1:] {
+				if _, ok := f.values[k]; ok {
+					delete(f.values, k)
+					n++
+				}
+			}
+			fmt.Fprintf(conn, ":%d\r\n", n)
+		case "SCAN":
+			keys := []string{}
+			for k := range f.values {
+				if ok, _ := path.Match(args[3], k); ok {
+					keys = append(keys, k)
+				}
+			}
+			fmt.Fprintf(conn, "*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+			for _, k := range keys {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(k), k)
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		f.lock.Unlock()
+	}
+}
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type RESPBackendTestSuite struct {
+	suite.Suite
+	server  *fakeRESP
+	backend Backend
+}
+
+func (suite *RESPBackendTestSuite) SetupTest() {
+	suite.server = newFakeRESP("S3CR3T")
+	suite.backend = NewRESPBackend(suite.server.listener.Addr().String(), "S3CR3T", 0, "argo-web-api:")
+}
+
+func (suite *RESPBackendTestSuite) TearDownTest() {
+	suite.server.listener.Close()
+}
+
+// TestGetSet checks that entries are namespaced, keep their time and expire
+func (suite *RESPBackendTestSuite) TestGetSet() {
+	stored := time.Unix(1412200000, 0)
+
+	_, _, found, err := suite.backend.Get("sites|GRNET")
+	suite.Nil(err)
+	suite.False(found)
+
+	err = suite.backend.Set("sites|GRNET", []byte("<root>\r\n</root>"), stored, time.Minute)
+	suite.Nil(err)
+	suite.Contains(suite.server.values, "argo-web-api:sites|GRNET")
+
+	output, when, found, err := suite.backend.Get("sites|GRNET")
+	suite.Nil(err)
+	suite.True(found)
+	suite.Equal("<root>\r\n</root>", string(output))
+	suite.True(stored.Equal(when))
+
+	suite.backend.Set("sites|EXPIRED", []byte("<root/>"), stored, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, _, found, _ = suite.backend.Get("sites|EXPIRED")
+	suite.False(found)
+}
+
+// TestPurge checks that keys are listed and deleted within the prefix only
+func (suite *RESPBackendTestSuite) TestPurge() {
+	suite.server.values["other:sites|GRNET"] = "0 <root/>"
+
+	suite.backend.Set("sites|GRNET", []byte("sites"), time.Now(), time.Minute)
+	suite.backend.Set("vos|ops", []byte("vos"), time.Now(), time.Minute)
+
+	keys, err := suite.backend.Keys()
+	suite.Nil(err)
+	suite.ElementsMatch([]string{"sites|GRNET", "vos|ops"}, keys)
+
+	n, err := suite.backend.Delete("sites|GRNET", "sites|MISSING")
+	suite.Nil(err)
+	suite.Equal(1, n)
+
+	n, err = suite.backend.Clear()
+	suite.Nil(err)
+	suite.Equal(1, n)
+	suite.Contains(suite.server.values, "other:sites|GRNET")
+}
+
+// TestAuthentication checks that a wrong password surfaces as an error
+func (suite *RESPBackendTestSuite) TestAuthentication() {
+	backend := NewRESPBackend(suite.server.listener.Addr().String(), "WRONG", 0, "argo-web-api:")
+	_, _, found, err := backend.Get("sites|GRNET")
+	suite.NotNil(err)
+	suite.False(found)
+}
+
+func TestRESPBackendTestSuite(t *testing.T) {
+	suite.Run(t, new(RESPBackendTestSuite))
+}
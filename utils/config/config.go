@@ -30,6 +30,9 @@ import (
 	"code.google.com/p/gcfg"
 	"flag"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 //All the flags that can be added when starting the PI
@@ -40,11 +43,21 @@ var flServerMaxProcs = flag.Int("maxprocs", 0, "specify the GOMAXPROCS")
 var flMongoHost = flag.String("mongo-host", "", "specify the IP address of the MongoDB instance")
 var flMongoPort = flag.Int("mongo-port", 0, "specify the port on which the MongoDB instance listens on")
 var flMongoDatabase = flag.String("mongo-db", "", "specify the MongoDB database to connect to")
+var flMongoUri = flag.String("mongo-uri", "", "specify the MongoDB connection URI, overriding the host and port")
+var flMongoHosts = flag.String("mongo-hosts", "", "specify a comma separated list of MongoDB seed hosts (host:port)")
+var flMongoReplicaSet = flag.String("mongo-replicaset", "", "specify the name of the MongoDB replica set")
+var flMongoUsername = flag.String("mongo-username", "", "specify the user to authenticate to MongoDB with")
+var flMongoPassword = flag.String("mongo-password", "", "specify the password to authenticate to MongoDB with")
+var flMongoAuthDb = flag.String("mongo-authdb", "", "specify the database the MongoDB user is defined in")
+var flMongoTls = flag.String("mongo-tls", "", "specify weather to connect to MongoDB over TLS or not [yes/no]")
+var flMongoCaFile = flag.String("mongo-cafile", "", "specify path to the CA bundle that signs the MongoDB certificates")
+var flMongoReadPreference = flag.String("mongo-readpreference", "", "specify the MongoDB read preference [primary/secondaryPreferred/secondary/nearest]")
 var flCache = flag.String("cache", "no", "specify weather to use cache or not [yes/no]")
 var flGzip = flag.String("gzip", "yes", "specify weather to use compression or not [yes/no]")
 var flProfile = flag.String("cpuprofile", "", "write cpu profile to file")
 var flCert = flag.String("cert", "", "speficy path to the host certificate")
 var flPrivKey = flag.String("privkey", "", "speficy path to the private key file")
+var flClientCa = flag.String("clientca", "", "specify path to the CA bundle that signs the client certificates")
 
 type Config struct {
 	Server struct {
@@ -56,15 +69,73 @@ type Config struct {
 		Gzip     bool
 		Cert     string
 		Privkey  string
+
+		Cachebackend  string // lru or redis
+		Redisaddr     string // host:port of the Redis compatible server
+		Redispassword string
+		Redisdb       int
+		Redisprefix   string // namespace of the cache keys in the server
 	}
 	MongoDB struct {
-		Host string
-		Port int
-		Db   string
+		Host           string
+		Port           int
+		Db             string
+		Collection     []string // collection name overrides in the form name:override
+		Poollimit      int      // maximum number of connections to MongoDB
+		Timeout        int      // seconds to wait for MongoDB when connecting
+		Sockettimeout  int      // seconds to wait for a reply to each operation
+		Readpreference string   // primary, secondaryPreferred, secondary or nearest
+		Uri            string   // mongodb:// connection URI, overrides host and port
+		Hosts          []string // seed hosts of a replica set in the form host:port
+		Replicaset     string
+		Username       string
+		Password       string
+		Authdb         string // database the user is defined in, defaults to db
+		Tls            bool
+		Cafile         string // CA bundle verifying the certificates of MongoDB
+	}
+	Cache struct {
+		Ttl    int      // seconds a cached response is served for
+		Region []string // per region overrides in the form region:seconds
+	}
+	Cachecontrol struct {
+		Default string   // Cache-Control header of the GET routes
+		Route   []string // per route overrides in the form route:directives
+	}
+	Reports struct {
+		Scope     []string
+		Sitescope []string
 	}
+	Authentication struct {
+		Clientca string // CA bundle verifying client certificates, none are requested when empty
+	}
+	Certificate map[string]*Certificate // client certificates accepted, by subject DN
+	Oidc        struct {
+		Issuer   string // iss claim of the accepted tokens, bearer tokens are refused when empty
+		Jwks     string // JSON Web Key Set of the issuer, reloaded when the file changes
+		Audience string // aud claim of the accepted tokens, if any
+		Claim    string // claim whose values are mapped to roles
+	}
+	Claim   map[string]*Certificate // roles granted by the values of the mapped claim
 	Profile string
 }
 
+// Certificate grants roles to the holder of a client certificate, or of a
+// bearer token carrying a claim value, e.g.
+//
+//	[certificate "/DC=org/DC=terena/DC=tcs/C=GR/O=GRNET/CN=John Doe"]
+//	name = "John Doe"
+//	role = recomputations:write
+//	ngi = NGI_GRNET
+//
+//	[claim "urn:mace:egi.eu:group:ops:role=manager"]
+//	role = profiles:write
+type Certificate struct {
+	Name string
+	Role []string
+	Ngi  []string // NGIs recomputations may be filed for, all when empty
+}
+
 const defaultConfig = `
     [server]
     bindip = ""
@@ -75,22 +146,33 @@ const defaultConfig = `
     gzip = true
     cert = /etc/pki/tls/certs/localhost.crt
     privkey = /etc/pki/tls/private/localhost.key
+    cachebackend = "lru"
+    redisaddr = "127.0.0.1:6379"
+    redisprefix = "argo-web-api:"
 
     [mongodb]
     host = "127.0.0.1"
     port = 27017
     db = "AR"
+    poollimit = 4096
+    timeout = 10
+    sockettimeout = 60
+    readpreference = "secondaryPreferred"
+
+    [cache]
+    ttl = 3600
+
+    [cachecontrol]
+    default = "no-cache"
 `
 
+// Scopes reported when neither the configuration file nor the request specify any
+const defaultScope = "EGI"
+
 //Loads the configurations passed either by flags or by the configuration file
 func LoadConfiguration() Config {
 	flag.Parse()
-	var cfg Config
-	if *flConfig != "" {
-		_ = gcfg.ReadFileInto(&cfg, *flConfig)
-	} else {
-		_ = gcfg.ReadStringInto(&cfg, defaultConfig)
-	}
+	cfg := readConfig(*flConfig)
 
 	var env = os.Getenv("EGI_AR_REST_API_ENV")
 	switch env {
@@ -100,6 +182,15 @@ func LoadConfiguration() Config {
 	case "production":
 	}
 
+	loadEnvironment(&cfg)
+
+	if len(cfg.Reports.Scope) == 0 {
+		cfg.Reports.Scope = []string{defaultScope}
+	}
+	if len(cfg.Reports.Sitescope) == 0 {
+		cfg.Reports.Sitescope = []string{defaultScope}
+	}
+
 	if *flServerIp != "" {
 		cfg.Server.Bindip = *flServerIp
 	}
@@ -118,6 +209,33 @@ func LoadConfiguration() Config {
 	if *flMongoDatabase != "" {
 		cfg.MongoDB.Db = *flMongoDatabase
 	}
+	if *flMongoUri != "" {
+		cfg.MongoDB.Uri = *flMongoUri
+	}
+	if *flMongoHosts != "" {
+		cfg.MongoDB.Hosts = strings.Split(*flMongoHosts, ",")
+	}
+	if *flMongoReplicaSet != "" {
+		cfg.MongoDB.Replicaset = *flMongoReplicaSet
+	}
+	if *flMongoUsername != "" {
+		cfg.MongoDB.Username = *flMongoUsername
+	}
+	if *flMongoPassword != "" {
+		cfg.MongoDB.Password = *flMongoPassword
+	}
+	if *flMongoAuthDb != "" {
+		cfg.MongoDB.Authdb = *flMongoAuthDb
+	}
+	if *flMongoTls != "" {
+		cfg.MongoDB.Tls = *flMongoTls == "yes"
+	}
+	if *flMongoCaFile != "" {
+		cfg.MongoDB.Cafile = *flMongoCaFile
+	}
+	if *flMongoReadPreference != "" {
+		cfg.MongoDB.Readpreference = *flMongoReadPreference
+	}
 	if *flCache == "yes" {
 		cfg.Server.Cache = true
 	}
@@ -136,5 +254,115 @@ func LoadConfiguration() Config {
 		cfg.Server.Privkey = *flPrivKey
 	}
 
+	if *flClientCa != "" {
+		cfg.Authentication.Clientca = *flClientCa
+	}
+
 	return cfg
 }
+
+// readConfig applies the settings of the configuration file at path, if any,
+// on top of the defaults. Multi-valued settings such as the report scopes are
+// left out of the defaults, since the file would append to them instead of
+// replacing them, and are defaulted by LoadConfiguration once read.
+func readConfig(path string) Config {
+	var cfg Config
+	_ = gcfg.ReadStringInto(&cfg, defaultConfig)
+	if path != "" {
+		_ = gcfg.ReadFileInto(&cfg, path)
+	}
+	return cfg
+}
+
+// Seconds a cached response is served for when the configuration sets no TTL
+const defaultCacheTTL = 3600
+
+// loadEnvironment overrides the MongoDB connection settings of the
+// configuration file with the EGI_AR_MONGO_* environment variables, so that
+// credentials need not be written in the file. Flags override both.
+func loadEnvironment(cfg *Config) {
+	if v := os.Getenv("EGI_AR_MONGO_URI"); v != "" {
+		cfg.MongoDB.Uri = v
+	}
+	if v := os.Getenv("EGI_AR_MONGO_HOSTS"); v != "" {
+		cfg.MongoDB.Hosts = strings.Split(v, ",")
+	}
+	if v := os.Getenv("EGI_AR_MONGO_DB"); v != "" {
+		cfg.MongoDB.Db = v
+	}
+	if v := os.Getenv("EGI_AR_MONGO_REPLICASET"); v != "" {
+		cfg.MongoDB.Replicaset = v
+	}
+	if v := os.Getenv("EGI_AR_MONGO_USERNAME"); v != "" {
+		cfg.MongoDB.Username = v
+	}
+	if v := os.Getenv("EGI_AR_MONGO_PASSWORD"); v != "" {
+		cfg.MongoDB.Password = v
+	}
+	if v := os.Getenv("EGI_AR_MONGO_AUTHDB"); v != "" {
+		cfg.MongoDB.Authdb = v
+	}
+	if v := os.Getenv("EGI_AR_MONGO_TLS"); v != "" {
+		cfg.MongoDB.Tls = v == "yes" || v == "true"
+	}
+	if v := os.Getenv("EGI_AR_MONGO_CAFILE"); v != "" {
+		cfg.MongoDB.Cafile = v
+	}
+	if v := os.Getenv("EGI_AR_MONGO_READPREFERENCE"); v != "" {
+		cfg.MongoDB.Readpreference = v
+	}
+}
+
+// CollectionName returns the name of the collection that stores the documents
+// of name, applying the overrides of the [mongodb] section e.g.
+//
+//	[mongodb]
+//	collection = "sites:sites_staging"
+//	collection = "status_metric:status_metric_staging"
+func (cfg Config) CollectionName(name string) string {
+	for _, override := range cfg.MongoDB.Collection {
+		pair := strings.SplitN(override, ":", 2)
+		if len(pair) == 2 && strings.TrimSpace(pair[0]) == name {
+			return strings.TrimSpace(pair[1])
+		}
+	}
+	return name
+}
+
+// CacheTTL returns how long the cached responses of a region are served for,
+// applying the overrides of the [cache] section e.g.
+//
+//	[cache]
+//	ttl = 3600
+//	region = "status_metrics:300"
+func (cfg Config) CacheTTL(region string) time.Duration {
+	seconds := cfg.Cache.Ttl
+	if seconds <= 0 {
+		seconds = defaultCacheTTL
+	}
+	for _, override := range cfg.Cache.Region {
+		pair := strings.SplitN(override, ":", 2)
+		if len(pair) == 2 && strings.TrimSpace(pair[0]) == region {
+			if n, err := strconv.Atoi(strings.TrimSpace(pair[1])); err == nil {
+				seconds = n
+			}
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// CacheControl returns the Cache-Control header of a named route, applying
+// the overrides of the [cachecontrol] section e.g.
+//
+//	[cachecontrol]
+//	default = "no-cache"
+//	route = "group_availability:public, max-age=60"
+func (cfg Config) CacheControl(route string) string {
+	for _, override := range cfg.Cachecontrol.Route {
+		pair := strings.SplitN(override, ":", 2)
+		if len(pair) == 2 && strings.TrimSpace(pair[0]) == route {
+			return strings.TrimSpace(pair[1])
+		}
+	}
+	return cfg.Cachecontrol.Default
+}
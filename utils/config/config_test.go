@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package config
+
+import (
+	"code.google.com/p/gcfg"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type ConfigTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (suite *ConfigTestSuite) SetupTest() {
+	suite.dir, _ = ioutil.TempDir("", "config")
+}
+
+func (suite *ConfigTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+// The settings a configuration file leaves out keep their defaults
+func (suite *ConfigTestSuite) TestReadConfig() {
+	path := filepath.Join(suite.dir, "argo-web-api.ini")
+	_ = ioutil.WriteFile(path, []byte(`
+[server]
+port = 8443
+cache = true
+
+[mongodb]
+db = "AR_staging"
+timeout = 5
+
+[reports]
+scope = "Local"
+`), 0600)
+
+	cfg := readConfig(path)
+
+	suite.Equal(8443, cfg.Server.Port)
+	suite.True(cfg.Server.Cache)
+	suite.True(cfg.Server.Gzip)
+	suite.Equal("lru", cfg.Server.Cachebackend)
+	suite.Equal("127.0.0.1:6379", cfg.Server.Redisaddr)
+	suite.Equal("AR_staging", cfg.MongoDB.Db)
+	suite.Equal("127.0.0.1", cfg.MongoDB.Host)
+	suite.Equal(4096, cfg.MongoDB.Poollimit)
+	suite.Equal(5, cfg.MongoDB.Timeout)
+	suite.Equal(60, cfg.MongoDB.Sockettimeout)
+	suite.Equal("secondaryPreferred", cfg.MongoDB.Readpreference)
+	suite.Equal(3600, cfg.Cache.Ttl)
+	suite.Equal("no-cache", cfg.Cachecontrol.Default)
+	suite.Equal([]string{"Local"}, cfg.Reports.Scope)
+	suite.Nil(cfg.Reports.Sitescope)
+}
+
+// Without a configuration file the defaults are used
+func (suite *ConfigTestSuite) TestReadDefaults() {
+	cfg := readConfig("")
+
+	suite.Equal(443, cfg.Server.Port)
+	suite.Equal("AR", cfg.MongoDB.Db)
+	suite.Equal(4096, cfg.MongoDB.Poollimit)
+}
+
+// The example configuration holds every section and matches the defaults
+func (suite *ConfigTestSuite) TestExample() {
+	var example Config
+	err := gcfg.ReadFileInto(&example, filepath.Join("..", "..", "argo-web-api.example.ini"))
+	suite.Nil(err)
+
+	defaults := readConfig("")
+	defaults.Reports.Scope = []string{defaultScope}
+	defaults.Reports.Sitescope = []string{defaultScope}
+	suite.Equal(defaults, example)
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
@@ -27,22 +27,154 @@
 package mongo
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/argoeu/argo-web-api/utils/config"
+	"io/ioutil"
 	"labix.org/v2/mgo"
+	"net"
+	"strings"
+	"sync"
+	"time"
 )
 
-func OpenSession(cfg config.Config) (*mgo.Session, error) {
-	s, err := mgo.Dial(cfg.MongoDB.Host + ":" + fmt.Sprint(cfg.MongoDB.Port))
+// The process wide session every request copies its own session from,
+// so that all requests share the same pool of connections
+var master *mgo.Session
+var masterLock sync.Mutex
+
+// InitSession connects to MongoDB and sets up the process wide session.
+// It is called at startup; OpenSession calls it lazily otherwise.
+func InitSession(cfg config.Config) error {
+	masterLock.Lock()
+	defer masterLock.Unlock()
+
+	if master != nil {
+		return nil
+	}
+
+	info, err := dialInfo(cfg)
 	if err != nil {
-		return s, err
+		return err
+	}
+
+	s, err := mgo.DialWithInfo(info)
+	if err != nil {
+		return err
+	}
+
+	if cfg.MongoDB.Poollimit > 0 {
+		s.SetPoolLimit(cfg.MongoDB.Poollimit)
 	}
-	// Optional. Switch the session to a monotonic behavior.
-	s.SetMode(mgo.Monotonic, true)
-	return s, err
+	if cfg.MongoDB.Sockettimeout > 0 {
+		s.SetSocketTimeout(time.Duration(cfg.MongoDB.Sockettimeout) * time.Second)
+	}
+	s.SetMode(readMode(cfg.MongoDB.Readpreference), true)
+
+	master = s
+	return nil
+}
+
+// dialInfo builds the connection settings out of the connection URI, or the
+// seed hosts, or the host and port, in that order. The replica set, credentials
+// and TLS settings of the configuration apply on top of those of the URI.
+func dialInfo(cfg config.Config) (*mgo.DialInfo, error) {
+	info := &mgo.DialInfo{}
+
+	if cfg.MongoDB.Uri != "" {
+		parsed, err := mgo.ParseURL(cfg.MongoDB.Uri)
+		if err != nil {
+			return nil, err
+		}
+		info = parsed
+	} else if len(cfg.MongoDB.Hosts) > 0 {
+		for _, host := range cfg.MongoDB.Hosts {
+			info.Addrs = append(info.Addrs, strings.TrimSpace(host))
+		}
+	} else {
+		info.Addrs = []string{cfg.MongoDB.Host + ":" + fmt.Sprint(cfg.MongoDB.Port)}
+	}
+
+	// A zero timeout would block forever when MongoDB is unreachable
+	info.Timeout = time.Duration(cfg.MongoDB.Timeout) * time.Second
+	if info.Timeout <= 0 {
+		info.Timeout = 10 * time.Second
+	}
+
+	if cfg.MongoDB.Replicaset != "" {
+		info.ReplicaSetName = cfg.MongoDB.Replicaset
+	}
+	if cfg.MongoDB.Username != "" {
+		info.Username = cfg.MongoDB.Username
+		info.Password = cfg.MongoDB.Password
+	}
+	if cfg.MongoDB.Authdb != "" {
+		info.Source = cfg.MongoDB.Authdb
+	}
+	if info.Username != "" && info.Source == "" && info.Database == "" {
+		info.Source = cfg.MongoDB.Db
+	}
+
+	if cfg.MongoDB.Tls {
+		tlsConfig := &tls.Config{}
+
+		if cfg.MongoDB.Cafile != "" {
+			pem, err := ioutil.ReadFile(cfg.MongoDB.Cafile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no certificates found in " + cfg.MongoDB.Cafile)
+			}
+		}
+
+		info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: info.Timeout}, "tcp", addr.String(), tlsConfig)
+		}
+	}
+
+	return info, nil
+}
+
+// readMode maps the configured read preference to the closest session
+// consistency mode: primary reads from the primary only, secondaryPreferred
+// reads from a secondary until the first write and from the primary afterwards,
+// secondary and nearest read from any member. Sessions are monotonic unless
+// configured otherwise.
+func readMode(preference string) mgo.Mode {
+	switch strings.ToLower(preference) {
+	case "primary", "strong":
+		return mgo.Strong
+	case "secondary", "nearest", "eventual":
+		return mgo.Eventual
+	}
+	return mgo.Monotonic
+}
+
+// OpenSession returns a copy of the process wide session. Every session
+// opened must be released with CloseSession to return its connection to the pool.
+func OpenSession(cfg config.Config) (*mgo.Session, error) {
+	if err := InitSession(cfg); err != nil {
+		return nil, err
+	}
+	return master.Copy(), nil
 }
 
 func CloseSession(session *mgo.Session) bool {
 	session.Close()
 	return true
 }
+
+// Shutdown closes the process wide session and all its connections
+func Shutdown() {
+	masterLock.Lock()
+	defer masterLock.Unlock()
+
+	if master != nil {
+		master.Close()
+		master = nil
+	}
+}
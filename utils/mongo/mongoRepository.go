@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package mongo
+
+import (
+	"github.com/argoeu/argo-web-api/utils/config"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+// A Repository gives access to the collections of the configured database.
+// Collections are addressed by their default name, which is replaced by the
+// override given in the [mongodb] section of the configuration, if any.
+type Repository struct {
+	session *mgo.Session
+	cfg     config.Config
+}
+
+func NewRepository(session *mgo.Session, cfg config.Config) *Repository {
+	return &Repository{session: session, cfg: cfg}
+}
+
+// C returns the collection that is stored under name
+func (repo *Repository) C(name string) *mgo.Collection {
+	return openCollection(repo.session, repo.cfg.MongoDB.Db, repo.cfg.CollectionName(name))
+}
+
+func (repo *Repository) Pipe(name string, query []bson.M, results interface{}) error {
+	return Pipe(repo.session, repo.cfg.MongoDB.Db, repo.cfg.CollectionName(name), query, results)
+}
+
+func (repo *Repository) Find(name string, query bson.M, sorter string, results interface{}) error {
+	return Find(repo.session, repo.cfg.MongoDB.Db, repo.cfg.CollectionName(name), query, sorter, results)
+}
+
+func (repo *Repository) Insert(name string, query bson.M) error {
+	return Insert(repo.session, repo.cfg.MongoDB.Db, repo.cfg.CollectionName(name), query)
+}
+
+func (repo *Repository) Remove(name string, query bson.M) (*mgo.ChangeInfo, error) {
+	return Remove(repo.session, repo.cfg.MongoDB.Db, repo.cfg.CollectionName(name), query)
+}
+
+func (repo *Repository) IdRemove(name string, id string) error {
+	return IdRemove(repo.session, repo.cfg.MongoDB.Db, repo.cfg.CollectionName(name), id)
+}
+
+func (repo *Repository) IdUpdate(name string, id string, update interface{}) error {
+	return IdUpdate(repo.session, repo.cfg.MongoDB.Db, repo.cfg.CollectionName(name), id, update)
+}
@@ -0,0 +1,339 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrTestFailed is returned when a test operation of a JSON Patch does not hold
+var ErrTestFailed = errors.New("Test operation failed")
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Merge applies a JSON Merge Patch (RFC 7396) to a document
+func Merge(doc []byte, patch []byte) ([]byte, error) {
+
+	var target, changes interface{}
+
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target interface{}, patch interface{}) interface{} {
+
+	changes, ok := patch.(map[string]interface{})
+
+	if !ok {
+		return patch
+	}
+
+	members, ok := target.(map[string]interface{})
+
+	if !ok {
+		members = map[string]interface{}{}
+	}
+
+	for name, value := range changes {
+		if value == nil {
+			delete(members, name)
+		} else {
+			members[name] = merge(members[name], value)
+		}
+	}
+
+	return members
+}
+
+// Apply applies the operations of a JSON Patch (RFC 6902) to a document. The
+// document is left untouched unless every operation succeeds.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+
+	var target interface{}
+	operations := []operation{}
+
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, err
+	}
+
+	for _, op := range operations {
+		var err error
+		if target, err = op.apply(target); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+
+	path, err := parsePointer(op.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, errors.New("Missing value of " + op.Op + " operation on " + op.Path)
+		}
+		if err = json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = get(doc, from); err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, errors.New("Cannot move " + op.From + " into itself")
+			}
+			if doc, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = clone(value)
+		}
+	case "remove":
+	default:
+		return nil, errors.New("Unsupported patch operation " + op.Op)
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return add(doc, path, value)
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "remove":
+		return remove(doc, path)
+	}
+
+	current, err := get(doc, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !reflect.DeepEqual(current, value) {
+		return nil, ErrTestFailed
+	}
+
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("Invalid path " + pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+func pathError(tokens []string) error {
+	return errors.New("No value at path /" + strings.Join(tokens, "/"))
+}
+
+// index parses an array index, which may point past the last element when
+// adding
+func index(token string, length int, adding bool) (int, error) {
+
+	if adding && token == "-" {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+
+	if err != nil || i < 0 || i > length || (i == length && !adding) || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.New("Invalid array index " + token)
+	}
+
+	return i, nil
+}
+
+func get(doc interface{}, tokens []string) (interface{}, error) {
+
+	for n, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, found := node[token]
+			if !found {
+				return nil, pathError(tokens[:n+1])
+			}
+			doc = value
+		case []interface{}:
+			i, err := index(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, pathError(tokens[:n+1])
+		}
+	}
+
+	return doc, nil
+}
+
+// update returns the document with the container of the value at tokens
+// replaced by the outcome of change, which is handed the container and the
+// last token
+func update(doc interface{}, tokens []string, change func(interface{}, string) (interface{}, error)) (interface{}, error) {
+
+	if len(tokens) == 1 {
+		return change(doc, tokens[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, found := node[tokens[0]]
+		if !found {
+			return nil, pathError(tokens[:1])
+		}
+		child, err := update(child, tokens[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = child
+		return node, nil
+	case []interface{}:
+		i, err := index(tokens[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], tokens[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+
+	return nil, pathError(tokens[:1])
+}
+
+func add(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return update(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := index(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, pathError(tokens)
+	})
+}
+
+func remove(doc interface{}, tokens []string) (interface{}, error) {
+
+	if len(tokens) == 0 {
+		return nil, errors.New("Cannot remove the whole document")
+	}
+
+	return update(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			if _, found := node[token]; !found {
+				return nil, pathError(tokens)
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := index(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, pathError(tokens)
+	})
+}
+
+func clone(value interface{}) interface{} {
+	data, _ := json.Marshal(value)
+	var copied interface{}
+	json.Unmarshal(data, &copied)
+	return copied
+}
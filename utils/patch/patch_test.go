@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package patch
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type PatchTestSuite struct {
+	suite.Suite
+}
+
+// TestMerge checks the examples of RFC 7396
+func (suite *PatchTestSuite) TestMerge() {
+	cases := [][3]string{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`["a","b"]`, `{"a":"b"}`, `{"a":"b"}`},
+	}
+
+	for _, c := range cases {
+		output, err := Merge([]byte(c[0]), []byte(c[1]))
+		suite.Nil(err)
+		suite.JSONEq(c[2], string(output), c[1])
+	}
+}
+
+// TestApply checks the operations of RFC 6902 on a profile like document
+func (suite *PatchTestSuite) TestApply() {
+	doc := `{"name":"ap1","poems":["p1"],"groups":[["CREAM-CE","ARC-CE"],["SRM"]]}`
+
+	cases := [][2]string{
+		{`[{"op":"replace","path":"/name","value":"ap2"}]`,
+			`{"name":"ap2","poems":["p1"],"groups":[["CREAM-CE","ARC-CE"],["SRM"]]}`},
+		{`[{"op":"add","path":"/groups/-","value":["Site-BDII"]}]`,
+			`{"name":"ap1","poems":["p1"],"groups":[["CREAM-CE","ARC-CE"],["SRM"],["Site-BDII"]]}`},
+		{`[{"op":"add","path":"/groups/1/0","value":"webdav"}]`,
+			`{"name":"ap1","poems":["p1"],"groups":[["CREAM-CE","ARC-CE"],["webdav","SRM"]]}`},
+		{`[{"op":"remove","path":"/groups/0/1"}]`,
+			`{"name":"ap1","poems":["p1"],"groups":[["CREAM-CE"],["SRM"]]}`},
+		{`[{"op":"move","path":"/groups/1/-","from":"/groups/0/1"}]`,
+			`{"name":"ap1","poems":["p1"],"groups":[["CREAM-CE"],["SRM","ARC-CE"]]}`},
+		{`[{"op":"copy","path":"/poems/-","from":"/poems/0"}]`,
+			`{"name":"ap1","poems":["p1","p1"],"groups":[["CREAM-CE","ARC-CE"],["SRM"]]}`},
+		{`[{"op":"test","path":"/name","value":"ap1"},{"op":"add","path":"/namespace","value":"ns"}]`,
+			`{"name":"ap1","namespace":"ns","poems":["p1"],"groups":[["CREAM-CE","ARC-CE"],["SRM"]]}`},
+	}
+
+	for _, c := range cases {
+		output, err := Apply([]byte(doc), []byte(c[0]))
+		suite.Nil(err, c[0])
+		suite.JSONEq(c[1], string(output), c[0])
+	}
+
+	_, err := Apply([]byte(doc), []byte(`[{"op":"test","path":"/name","value":"ap2"}]`))
+	suite.Equal(ErrTestFailed, err)
+
+	for _, invalid := range []string{
+		`[{"op":"remove","path":"/namespace"}]`,
+		`[{"op":"replace","path":"/groups/2","value":[]}]`,
+		`[{"op":"add","path":"/groups/01","value":[]}]`,
+		`[{"op":"add","path":"name","value":"ap2"}]`,
+		`[{"op":"add","path":"/name"}]`,
+		`[{"op":"move","path":"/groups/0/0","from":"/groups/0"}]`,
+		`[{"op":"frobnicate","path":"/name"}]`,
+		`{"op":"add","path":"/name","value":"ap2"}`,
+	} {
+		_, err = Apply([]byte(doc), []byte(invalid))
+		suite.NotNil(err, invalid)
+	}
+}
+
+func TestPatchTestSuite(t *testing.T) {
+	suite.Run(t, new(PatchTestSuite))
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package periods
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// A Period is a calendar duration expressed in years, months and days,
+// as given by an ISO 8601 duration such as P7D, P1M or P3M
+type Period struct {
+	Years  int
+	Months int
+	Days   int
+}
+
+var ErrInvalidPeriod = errors.New("invalid ISO 8601 period")
+
+// MaxDays bounds the span of a period, which cannot usefully exceed the
+// history the reports are computed from
+const MaxDays = 100 * 366
+
+var durationRe = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?$`)
+
+// A Bucketer maps a day to the first day of the period it is reported in
+type Bucketer func(day time.Time) time.Time
+
+// Weekly buckets days into ISO 8601 weeks, which start on Monday
+func Weekly(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// Parse reads an ISO 8601 duration made of years, months, weeks and days.
+// Durations with a time part (e.g. PT1H) are not supported since the
+// reports are computed out of daily documents, and periods spanning more
+// than MaxDays are rejected.
+func Parse(value string) (Period, error) {
+	match := durationRe.FindStringSubmatch(value)
+	if match == nil {
+		return Period{}, ErrInvalidPeriod
+	}
+
+	n := make([]int, len(match))
+	for i := 1; i < len(match); i++ {
+		if len(match[i]) > 0 {
+			var err error
+			// Bounding every part first keeps the sums below from overflowing
+			if n[i], err = strconv.Atoi(match[i]); err != nil || n[i] > MaxDays {
+				return Period{}, ErrInvalidPeriod
+			}
+		}
+	}
+
+	period := Period{Years: n[1], Months: n[2], Days: n[3]*7 + n[4]}
+	if period.Years == 0 && period.Months == 0 && period.Days == 0 {
+		return Period{}, ErrInvalidPeriod
+	}
+
+	if period.approxDays() > MaxDays {
+		return Period{}, ErrInvalidPeriod
+	}
+
+	return period, nil
+}
+
+// approxDays is the average length of the period in days
+func (period Period) approxDays() float64 {
+	return float64(period.Years)*365.2425 + float64(period.Months)*30.436875 + float64(period.Days)
+}
+
+// Anchored buckets days into consecutive periods starting at the day of
+// start. Days before start are reported in the first period.
+func Anchored(start time.Time, period Period) Bucketer {
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	// Always offset from start so that month lengths do not accumulate drift
+	nth := func(n int) time.Time {
+		return start.AddDate(n*period.Years, n*period.Months, n*period.Days)
+	}
+
+	return func(day time.Time) time.Time {
+		if !day.After(start) {
+			return start
+		}
+
+		// The index of the bucket is estimated out of the average length of
+		// the period, which is off by a period or so, and then corrected
+		n := int(day.Sub(start).Hours() / 24 / period.approxDays())
+		for n > 0 && nth(n).After(day) {
+			n--
+		}
+		for !nth(n + 1).After(day) {
+			n++
+		}
+
+		return nth(n)
+	}
+}
+
+// A Row is a daily document of a report. Key identifies the report it
+// belongs to and may be any comparable value, e.g. an array of names.
+type Row struct {
+	Key    interface{}
+	Day    time.Time
+	Values []float64
+}
+
+// An Average holds the mean values of the rows of a report that were
+// bucketed in the period starting at Start. First is the index of the first
+// of those rows, so that callers can copy the attributes of the report.
+type Average struct {
+	First  int
+	Start  time.Time
+	Values []float64
+}
+
+// Aggregate averages the values of each report over the period that bucket
+// assigns every day to. Only the days that were reported are counted and
+// the rows must be sorted by key and day.
+func Aggregate(rows []Row, bucket Bucketer) []Average {
+
+	averages := []Average{}
+	days := []float64{}
+
+	for i, row := range rows {
+		start := bucket(row.Day)
+
+		last := len(averages) - 1
+		if last < 0 || !averages[last].Start.Equal(start) || rows[averages[last].First].Key != row.Key {
+			averages = append(averages, Average{First: i, Start: start, Values: append([]float64{}, row.Values...)})
+			days = append(days, 1)
+			continue
+		}
+
+		for j := range averages[last].Values {
+			averages[last].Values[j] += row.Values[j]
+		}
+		days[last]++
+	}
+
+	for i := range averages {
+		for j := range averages[i].Values {
+			averages[i].Values[j] /= days[i]
+		}
+	}
+
+	return averages
+}
+
+// Availability computes the availability percentage out of the average
+// up, unknown and downtime fractions of a period the same way as the
+// monthly aggregation pipelines do:
+// availability = (avgup/(1.00000001 - avgu))*100
+func Availability(up float64, unknown float64, down float64) float64 {
+	return (up / (1.00000001 - unknown)) * 100
+}
+
+// Reliability computes the reliability percentage out of the average
+// up, unknown and downtime fractions of a period:
+// reliability = (avgup/((1.00000001 - avgu)-avgd))*100
+func Reliability(up float64, unknown float64, down float64) float64 {
+	return (up / ((1.00000001 - unknown) - down)) * 100
+}
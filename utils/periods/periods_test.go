@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package periods
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type PeriodsTestSuite struct {
+	suite.Suite
+}
+
+func day(value string) time.Time {
+	t, _ := time.Parse("20060102", value)
+	return t
+}
+
+// TestParse checks the supported ISO 8601 durations and rejects the rest
+func (suite *PeriodsTestSuite) TestParse() {
+	period, err := Parse("P7D")
+	suite.Nil(err)
+	suite.Equal(Period{Days: 7}, period)
+
+	period, err = Parse("P3M")
+	suite.Nil(err)
+	suite.Equal(Period{Months: 3}, period)
+
+	period, err = Parse("P1Y2M2W3D")
+	suite.Nil(err)
+	suite.Equal(Period{Years: 1, Months: 2, Days: 17}, period)
+
+	for _, value := range []string{"", "P", "P0D", "PT1H", "7D", "P1.5M", "p1m"} {
+		_, err = Parse(value)
+		suite.Equal(ErrInvalidPeriod, err, value)
+	}
+}
+
+// TestParseLarge checks that periods overflowing an int or spanning more
+// than MaxDays are rejected
+func (suite *PeriodsTestSuite) TestParseLarge() {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"P100Y", true},
+		{"P1200M", true},
+		{"P36600D", true},
+		{"P101Y", false},
+		{"P1300M", false},
+		{"P5300W", false},
+		{"P36601D", false},
+		{"P99Y99M", false},
+		{"P300000000000Y", false},
+		{"P9223372036854775807D", false},
+		{"P99999999999999999999W", false},
+		{"P1Y36600D", false},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.value)
+		suite.Equal(test.valid, err == nil, test.value)
+	}
+}
+
+// TestAnchored checks that periods are counted from the start of the report
+func (suite *PeriodsTestSuite) TestAnchored() {
+	start, _ := time.Parse("2006-01-02T15:04:05Z", "2014-01-15T10:00:00Z")
+
+	bucket := Anchored(start, Period{Months: 1})
+	suite.Equal(day("20140115"), bucket(day("20140115")))
+	suite.Equal(day("20140115"), bucket(day("20140214")))
+	suite.Equal(day("20140215"), bucket(day("20140215")))
+	suite.Equal(day("20140415"), bucket(day("20140501")))
+
+	bucket = Anchored(start, Period{Days: 30})
+	suite.Equal(day("20140115"), bucket(day("20140213")))
+	suite.Equal(day("20140214"), bucket(day("20140214")))
+}
+
+// TestAnchoredFar checks that days far from the start of the report are
+// bucketed right and without walking every period in between
+func (suite *PeriodsTestSuite) TestAnchoredFar() {
+	start := day("20140131")
+
+	tests := []struct {
+		period Period
+		day    string
+		bucket string
+	}{
+		{Period{Days: 1}, "20140130", "20140131"},
+		{Period{Days: 1}, "21140131", "21140131"},
+		{Period{Months: 1}, "20140227", "20140131"},
+		{Period{Months: 1}, "20140303", "20140303"},
+		{Period{Months: 1}, "20640130", "20631231"},
+		{Period{Years: 1}, "20150130", "20140131"},
+		{Period{Years: 1}, "20150131", "20150131"},
+		{Period{Days: 7}, "20140213", "20140207"},
+		{Period{Days: MaxDays}, "21140131", "20140131"},
+	}
+
+	for _, test := range tests {
+		suite.Equal(day(test.bucket), Anchored(start, test.period)(day(test.day)), test.day)
+	}
+}
+
+// TestWeekly checks that weeks start on Monday
+func (suite *PeriodsTestSuite) TestWeekly() {
+	suite.Equal(day("20141006"), Weekly(day("20141006")))
+	suite.Equal(day("20141006"), Weekly(day("20141008")))
+	suite.Equal(day("20141006"), Weekly(day("20141012")))
+}
+
+// row is a daily uptime, unknown and downtime fraction of report key
+func row(key string, date string, up float64, unknown float64, down float64) Row {
+	return Row{Key: key, Day: day(date), Values: []float64{up, unknown, down}}
+}
+
+// TestAggregate checks that days are averaged per report into their period,
+// which only holds the days that were reported
+func (suite *PeriodsTestSuite) TestAggregate() {
+
+	cases := []struct {
+		name     string
+		bucket   Bucketer
+		rows     []Row
+		expected []Average
+	}{
+		{
+			"weekly periods with partial first and last weeks",
+			Weekly,
+			[]Row{
+				row("HG-03-AUTH", "20141001", 1, 0, 0),
+				row("HG-03-AUTH", "20141002", 1, 0, 0),
+				row("HG-03-AUTH", "20141003", 0.5, 0.5, 0),
+				row("HG-03-AUTH", "20141004", 0.5, 0, 0.5),
+				row("HG-03-AUTH", "20141005", 1, 0, 0),
+				row("HG-03-AUTH", "20141006", 0, 0, 1),
+				row("HG-03-AUTH", "20141007", 1, 0, 0),
+			},
+			[]Average{
+				{0, day("20140929"), []float64{0.8, 0.1, 0.1}},
+				{5, day("20141006"), []float64{0.5, 0, 0.5}},
+			},
+		},
+		{
+			"weekly periods of several reports",
+			Weekly,
+			[]Row{
+				row("GR-01-AUTH", "20141006", 1, 0, 0),
+				row("GR-01-AUTH", "20141007", 0, 1, 0),
+				row("HG-03-AUTH", "20141006", 0.25, 0, 0.75),
+				row("HG-03-AUTH", "20141007", 0.75, 0, 0.25),
+			},
+			[]Average{
+				{0, day("20141006"), []float64{0.5, 0.5, 0}},
+				{2, day("20141006"), []float64{0.5, 0, 0.5}},
+			},
+		},
+		{
+			"P1Y periods anchored at the start of a year",
+			Anchored(day("20140101"), Period{Years: 1}),
+			[]Row{
+				row("HG-03-AUTH", "20141230", 1, 0, 0),
+				row("HG-03-AUTH", "20141231", 0, 0, 1),
+				row("HG-03-AUTH", "20150101", 1, 0, 0),
+			},
+			[]Average{
+				{0, day("20140101"), []float64{0.5, 0, 0.5}},
+				{2, day("20150101"), []float64{1, 0, 0}},
+			},
+		},
+		{
+			"P1Y periods anchored mid year",
+			Anchored(day("20140601"), Period{Years: 1}),
+			[]Row{
+				row("HG-03-AUTH", "20150530", 1, 0, 0),
+				row("HG-03-AUTH", "20150531", 0.5, 0.5, 0),
+				row("HG-03-AUTH", "20150601", 0.5, 0, 0.5),
+			},
+			[]Average{
+				{0, day("20140601"), []float64{0.75, 0.25, 0}},
+				{2, day("20150601"), []float64{0.5, 0, 0.5}},
+			},
+		},
+		{
+			"keys made of several names",
+			Anchored(day("20141001"), Period{Months: 1}),
+			[]Row{
+				{[2]string{"ap1", "NGI_GRNET"}, day("20141001"), []float64{90, 95}},
+				{[2]string{"ap1", "NGI_GRNET"}, day("20141002"), []float64{100, 100}},
+				{[2]string{"ap2", "NGI_GRNET"}, day("20141002"), []float64{50, 60}},
+			},
+			[]Average{
+				{0, day("20141001"), []float64{95, 97.5}},
+				{2, day("20141001"), []float64{50, 60}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		averages := Aggregate(c.rows, c.bucket)
+
+		suite.Equal(len(c.expected), len(averages), c.name)
+		for i := 0; i < len(c.expected) && i < len(averages); i++ {
+			e, a := c.expected[i], averages[i]
+			suite.Equal(e.First, a.First, c.name)
+			suite.Equal(e.Start, a.Start, c.name)
+			suite.InDeltaSlice(e.Values, a.Values, 1e-9, c.name)
+		}
+	}
+}
+
+// TestAggregateUnchanged checks that the rows are not modified
+func (suite *PeriodsTestSuite) TestAggregateUnchanged() {
+	rows := []Row{row("HG-03-AUTH", "20141006", 1, 0, 0), row("HG-03-AUTH", "20141007", 0, 0, 1)}
+
+	Aggregate(rows, Weekly)
+	suite.Equal([]float64{1, 0, 0}, rows[0].Values)
+}
+
+// A week with some downtime is 88.9% available but still 100% reliable, since
+// downtime does not count against reliability
+func (suite *PeriodsTestSuite) TestPercentages() {
+	averages := Aggregate([]Row{
+		row("HG-03-AUTH", "20141001", 1, 0, 0),
+		row("HG-03-AUTH", "20141002", 1, 0, 0),
+		row("HG-03-AUTH", "20141003", 0.5, 0.5, 0),
+		row("HG-03-AUTH", "20141004", 0.5, 0, 0.5),
+		row("HG-03-AUTH", "20141005", 1, 0, 0),
+	}, Weekly)
+
+	suite.Equal(1, len(averages))
+	suite.InDelta(88.889, Availability(averages[0].Values[0], averages[0].Values[1], averages[0].Values[2]), 0.001)
+	suite.InDelta(100, Reliability(averages[0].Values[0], averages[0].Values[1], averages[0].Values[2]), 0.001)
+}
+
+func TestPeriodsTestSuite(t *testing.T) {
+	suite.Run(t, new(PeriodsTestSuite))
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A csvTable collects the rows of a flattened document. Columns are named
+// after the element and the attribute they come from (e.g. Site.NGI) and
+// appear in the order they were first met.
+type csvTable struct {
+	columns []string
+	index   map[string]int
+	rows    []map[string]string
+}
+
+type csvChild struct {
+	value reflect.Value
+	label string
+}
+
+// marshalCSV flattens a view document into one CSV row per leaf element.
+// Every row repeats the attributes of the elements above the leaf so that
+// the hierarchy of the XML and JSON documents is kept in the columns.
+func marshalCSV(v interface{}) ([]byte, error) {
+
+	table := &csvTable{index: map[string]int{}}
+	table.walk(reflect.ValueOf(v), "", []string{}, map[string]string{})
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if len(table.columns) > 0 {
+		w.Write(table.columns)
+	}
+
+	for _, row := range table.rows {
+		record := make([]string, len(table.columns))
+		for column, value := range row {
+			record[table.index[column]] = value
+		}
+		w.Write(record)
+	}
+
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+// walk visits an element and returns whether any row was written for it or
+// for its descendants. Elements without children end up as rows.
+func (table *csvTable) walk(v reflect.Value, label string, path []string, values map[string]string) bool {
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	if len(path) > 0 {
+		label = uniqueLabel(elementName(v, label), path)
+	}
+
+	row := map[string]string{}
+	for column, value := range values {
+		row[column] = value
+	}
+
+	children := []csvChild{}
+	typ := v.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, skip := fieldName(field)
+
+		if skip {
+			continue
+		}
+
+		fv := v.Field(i)
+
+		switch {
+		case fv.Kind() == reflect.Slice && isElement(fv.Type().Elem()):
+			for j := 0; j < fv.Len(); j++ {
+				children = append(children, csvChild{fv.Index(j), name})
+			}
+		case isElement(fv.Type()):
+			children = append(children, csvChild{fv, name})
+		case fv.Kind() == reflect.Slice:
+			items := []string{}
+			for j := 0; j < fv.Len(); j++ {
+				items = append(items, fmt.Sprint(fv.Index(j).Interface()))
+			}
+			table.set(row, label, name, strings.Join(items, ";"))
+		default:
+			table.set(row, label, name, fmt.Sprint(fv.Interface()))
+		}
+	}
+
+	written := false
+	for _, child := range children {
+		if table.walk(child.value, child.label, append(path, label), row) {
+			written = true
+		}
+	}
+
+	if !written && len(row) > 0 {
+		table.rows = append(table.rows, row)
+		written = true
+	}
+
+	return written
+}
+
+func (table *csvTable) set(row map[string]string, label string, name string, value string) {
+
+	column := name
+	if label != "" {
+		column = label + "." + name
+	}
+
+	if _, found := table.index[column]; !found {
+		table.index[column] = len(table.columns)
+		table.columns = append(table.columns, column)
+	}
+
+	row[column] = value
+}
+
+// elementName returns the xml name of an element, falling back to the name
+// of the field that holds it
+func elementName(v reflect.Value, fallback string) string {
+
+	if field, found := v.Type().FieldByName("XMLName"); found {
+		if name := strings.Split(field.Tag.Get("xml"), ",")[0]; name != "" {
+			return name
+		}
+	}
+
+	return fallback
+}
+
+// uniqueLabel numbers elements that nest into elements of the same name
+// (e.g. group, group2, group3) so that their columns do not collide
+func uniqueLabel(label string, path []string) string {
+
+	count := 0
+	for _, ancestor := range path {
+		if strings.TrimRight(ancestor, "0123456789") == label {
+			count++
+		}
+	}
+
+	if count > 0 {
+		return label + strconv.Itoa(count+1)
+	}
+
+	return label
+}
+
+func fieldName(field reflect.StructField) (string, bool) {
+
+	if field.PkgPath != "" || field.Name == "XMLName" {
+		return "", true
+	}
+
+	tag := field.Tag.Get("xml")
+	if tag == "-" {
+		return "", true
+	}
+
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, false
+	}
+
+	return field.Name, false
+}
+
+func isElement(typ reflect.Type) bool {
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	return typ.Kind() == reflect.Struct || typ.Kind() == reflect.Interface
+}
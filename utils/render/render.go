@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types that every call of the API can be rendered into
+const (
+	XML  = "application/xml"
+	JSON = "application/json"
+	CSV  = "text/csv"
+)
+
+// YAML is only offered by the calls that write bundles, see Bundles
+const YAML = "application/yaml"
+
+// ErrNotAcceptable is returned when none of the media types accepted by the client can be produced
+var ErrNotAcceptable = errors.New("None of the requested media types is supported")
+
+// The values of the legacy format parameter along with the media type they stand for
+var formats = map[string]string{
+	"xml":  XML,
+	"json": JSON,
+	"csv":  CSV,
+	"yaml": YAML,
+}
+
+// Supported media types. When a client accepts several of them with the same
+// quality the first one in this list is preferred.
+var supported = []string{XML, "text/xml", JSON, CSV}
+
+// Bundles are the media types of the calls that write bundles, in JSON unless
+// YAML is asked for
+var Bundles = []string{JSON, YAML, "application/x-yaml"}
+
+type contextKey struct{}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+type byQuality []mediaRange
+
+func (a byQuality) Len() int           { return len(a) }
+func (a byQuality) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byQuality) Less(i, j int) bool { return a[i].q > a[j].q }
+
+// Negotiate selects the media type of the response. The format parameter
+// that older clients pass in the query takes precedence over the Accept
+// header. Requests that express no preference are answered in XML.
+func Negotiate(r *http.Request) (string, error) {
+	return NegotiateFrom(r, supported)
+}
+
+// NegotiateFrom selects the media type of the response among the offered
+// ones. Requests that express no preference get the first one.
+func NegotiateFrom(r *http.Request, offered []string) (string, error) {
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		if contentType, found := formats[strings.ToLower(format)]; found && contains(offered, contentType) {
+			return contentType, nil
+		}
+		return offered[0], ErrNotAcceptable
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offered[0], nil
+	}
+
+	for _, mr := range parseAccept(accept) {
+		for _, contentType := range offered {
+			if matches(mr.mediaType, contentType) {
+				return contentType, nil
+			}
+		}
+	}
+
+	return offered[0], ErrNotAcceptable
+}
+
+// WithContentType returns a copy of r carrying the negotiated media type
+func WithContentType(r *http.Request, contentType string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, contentType))
+}
+
+// FromRequest returns the media type negotiated for a request. Requests that
+// were not negotiated yet are negotiated among the supported media types.
+func FromRequest(r *http.Request) string {
+	if contentType, found := r.Context().Value(contextKey{}).(string); found {
+		return contentType
+	}
+	contentType, _ := Negotiate(r)
+	return contentType
+}
+
+// A CSVMarshaler writes itself in CSV instead of being flattened by Marshal
+type CSVMarshaler interface {
+	MarshalCSV() ([]byte, error)
+}
+
+// Output renders what a handler returned. Documents are serialized into the
+// negotiated media type while bytes, which are rendered already (e.g. cached
+// responses), are kept as they are. Nothing is rendered as an empty body.
+func Output(contentType string, output interface{}) ([]byte, error) {
+
+	if output == nil {
+		return []byte(""), nil
+	}
+
+	if rendered, ok := output.([]byte); ok {
+		return rendered, nil
+	}
+
+	return Marshal(contentType, output)
+}
+
+// Marshal serializes a view document into the negotiated media type
+func Marshal(contentType string, v interface{}) ([]byte, error) {
+
+	switch contentType {
+	case JSON:
+		return json.MarshalIndent(v, " ", "  ")
+	case CSV:
+		if m, ok := v.(CSVMarshaler); ok {
+			return m.MarshalCSV()
+		}
+		return marshalCSV(v)
+	case YAML, "application/x-yaml":
+		return yaml.Marshal(v)
+	}
+
+	return xml.MarshalIndent(v, " ", "  ")
+}
+
+// ContentType returns the value of the Content-Type header for a media type
+func ContentType(contentType string) string {
+	return fmt.Sprintf("%s; charset=%s", contentType, "utf-8")
+}
+
+// Supported lists the media types that can be negotiated
+func Supported() []string {
+	return append([]string{}, supported...)
+}
+
+// parseAccept splits an Accept header into its media ranges ordered by
+// quality. Ranges with q=0 are explicitly refused by the client and dropped.
+func parseAccept(accept string) []mediaRange {
+
+	ranges := []mediaRange{}
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mr := mediaRange{strings.ToLower(strings.TrimSpace(params[0])), 1}
+
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+
+		if mr.mediaType != "" && mr.q > 0 {
+			ranges = append(ranges, mr)
+		}
+	}
+
+	sort.Stable(byQuality(ranges))
+	return ranges
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(mediaRange string, contentType string) bool {
+
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
+	}
+
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(contentType, strings.TrimSuffix(mediaRange, "*"))
+	}
+
+	return false
+}
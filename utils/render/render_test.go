@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package render
+
+import (
+	"encoding/xml"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type RenderTestSuite struct {
+	suite.Suite
+}
+
+type testStatus struct {
+	XMLName   xml.Name `xml:"status"`
+	Timestamp string   `xml:"timestamp,attr"`
+	Status    string   `xml:"status,attr"`
+}
+
+type testGroup struct {
+	XMLName  xml.Name `xml:"group"`
+	Name     string   `xml:"name,attr"`
+	Groups   []*testGroup
+	Timeline []*testStatus
+}
+
+type testRoot struct {
+	XMLName xml.Name `xml:"root"`
+	Groups  []*testGroup
+}
+
+func newRequest(url string, accept string) *http.Request {
+	request, _ := http.NewRequest("GET", url, nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	return request
+}
+
+// Requests without any preference are answered in XML, the format parameter
+// overrides the Accept header and quality values order the accepted types
+func (suite *RenderTestSuite) TestNegotiate() {
+
+	cases := []struct {
+		url         string
+		accept      string
+		contentType string
+		err         error
+	}{
+		{"/api/v1/factors", "", XML, nil},
+		{"/api/v1/factors", "application/json", JSON, nil},
+		{"/api/v1/factors", "text/html, text/*;q=0.8", "text/xml", nil},
+		{"/api/v1/factors", "application/xml;q=0.5, text/csv", CSV, nil},
+		{"/api/v1/factors", "application/json;q=0, */*", XML, nil},
+		{"/api/v1/factors", "image/png", XML, ErrNotAcceptable},
+		{"/api/v1/factors?format=json", "text/csv", JSON, nil},
+		{"/api/v1/factors?format=yaml", "", XML, ErrNotAcceptable},
+	}
+
+	for _, c := range cases {
+		contentType, err := Negotiate(newRequest(c.url, c.accept))
+		suite.Equal(c.contentType, contentType, c.url+" "+c.accept)
+		suite.Equal(c.err, err, c.url+" "+c.accept)
+	}
+}
+
+// YAML is only negotiated by the calls that offer it, with either the format
+// parameter or the Accept header
+func (suite *RenderTestSuite) TestNegotiateFrom() {
+
+	cases := []struct {
+		url         string
+		accept      string
+		contentType string
+		err         error
+	}{
+		{"/api/v1/AP/export", "", JSON, nil},
+		{"/api/v1/AP/export?format=yaml", "", YAML, nil},
+		{"/api/v1/AP/export", "application/yaml", YAML, nil},
+		{"/api/v1/AP/export", "application/x-yaml", "application/x-yaml", nil},
+		{"/api/v1/AP/export", "*/*", JSON, nil},
+		{"/api/v1/AP/export?format=xml", "", JSON, ErrNotAcceptable},
+		{"/api/v1/AP/export", "application/xml", JSON, ErrNotAcceptable},
+	}
+
+	for _, c := range cases {
+		contentType, err := NegotiateFrom(newRequest(c.url, c.accept), Bundles)
+		suite.Equal(c.contentType, contentType, c.url+" "+c.accept)
+		suite.Equal(c.err, err, c.url+" "+c.accept)
+	}
+}
+
+// The negotiated media type travels with the request
+func (suite *RenderTestSuite) TestFromRequest() {
+
+	request := newRequest("/api/v1/AP/export", "application/json")
+
+	suite.Equal(JSON, FromRequest(request))
+	suite.Equal(YAML, FromRequest(WithContentType(request, YAML)))
+}
+
+// Nested elements of the same name get numbered columns and every leaf
+// element becomes a row carrying the attributes of its ancestors
+func (suite *RenderTestSuite) TestMarshalCSV() {
+
+	docRoot := &testRoot{Groups: []*testGroup{
+		{Name: "NGI_GRNET", Groups: []*testGroup{
+			{Name: "HG-03-AUTH", Timeline: []*testStatus{
+				{Timestamp: "2014-10-01T22:00:00Z", Status: "OK"},
+				{Timestamp: "2014-10-02T03:00:00Z", Status: "CRITICAL"},
+			}},
+		}},
+	}}
+
+	output, err := Marshal(CSV, docRoot)
+
+	suite.Nil(err)
+	suite.Equal("group.name,group2.name,status.timestamp,status.status\n"+
+		"NGI_GRNET,HG-03-AUTH,2014-10-01T22:00:00Z,OK\n"+
+		"NGI_GRNET,HG-03-AUTH,2014-10-02T03:00:00Z,CRITICAL\n", string(output))
+}
+
+type testReport []string
+
+func (report testReport) MarshalCSV() ([]byte, error) {
+	return []byte("day\n" + strings.Join(report, "\n") + "\n"), nil
+}
+
+// Documents are marshalled, rendered bytes are kept as they are and reports
+// that write their own CSV are not flattened
+func (suite *RenderTestSuite) TestOutput() {
+
+	output, err := Output(XML, &testStatus{Timestamp: "2014-10-01T22:00:00Z", Status: "OK"})
+	suite.Nil(err)
+	suite.Equal(` <status timestamp="2014-10-01T22:00:00Z" status="OK"></status>`, string(output))
+
+	output, err = Output(JSON, []byte("<root/>"))
+	suite.Nil(err)
+	suite.Equal("<root/>", string(output))
+
+	output, err = Output(XML, nil)
+	suite.Nil(err)
+	suite.Equal("", string(output))
+
+	output, err = Output(CSV, testReport{"20141001", "20141002"})
+	suite.Nil(err)
+	suite.Equal("day\n20141001\n20141002\n", string(output))
+}
+
+func TestRenderTestSuite(t *testing.T) {
+	suite.Run(t, new(RenderTestSuite))
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package window
+
+import (
+	"labix.org/v2/mgo/bson"
+)
+
+// Query matches the status documents of every day that falls inside the
+// requested window. Documents are stored per day (di, as YYYYMMDD) along with
+// their time of day (ti, as HHMMSS), so only the first and the last day are
+// bounded by time.
+func Query(tsYMD int, tsTime int, teYMD int, teTime int) bson.M {
+
+	if tsYMD == teYMD {
+		return bson.M{
+			"di": tsYMD,
+			"ti": bson.M{"$gte": tsTime, "$lte": teTime},
+		}
+	}
+
+	return bson.M{
+		"$or": []bson.M{
+			{"di": tsYMD, "ti": bson.M{"$gte": tsTime}},
+			{"di": bson.M{"$gt": tsYMD, "$lt": teYMD}},
+			{"di": teYMD, "ti": bson.M{"$lte": teTime}},
+		},
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2014 GRNET S.A., SRCE, IN2P3 CNRS Computing Centre
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language
+ * governing permissions and limitations under the License.
+ *
+ * The views and conclusions contained in the software and
+ * documentation are those of the authors and should not be
+ * interpreted as representing official policies, either expressed
+ * or implied, of either GRNET S.A., SRCE or IN2P3 CNRS Computing
+ * Centre
+ *
+ * The work represented by this source file is partially funded by
+ * the EGI-InSPIRE project through the European Commission's 7th
+ * Framework Programme (contract # INFSO-RI-261323)
+ */
+
+package window
+
+import (
+	"github.com/stretchr/testify/suite"
+	"labix.org/v2/mgo/bson"
+	"testing"
+)
+
+// This is a util. suite struct used in tests (see pkg "testify")
+type WindowTestSuite struct {
+	suite.Suite
+}
+
+// A window within a single day bounds the time of that day on both ends
+func (suite *WindowTestSuite) TestSingleDay() {
+
+	query := Query(20141001, 100000, 20141001, 235959)
+
+	suite.Equal(bson.M{
+		"di": 20141001,
+		"ti": bson.M{"$gte": 100000, "$lte": 235959},
+	}, query)
+}
+
+// A window over several days bounds the time of the first and the last day
+// only and matches the days in between whole
+func (suite *WindowTestSuite) TestMultiDay() {
+
+	suite.Equal(bson.M{
+		"$or": []bson.M{
+			{"di": 20141001, "ti": bson.M{"$gte": 220000}},
+			{"di": bson.M{"$gt": 20141001, "$lt": 20141002}},
+			{"di": 20141002, "ti": bson.M{"$lte": 30000}},
+		},
+	}, Query(20141001, 220000, 20141002, 30000))
+
+	suite.Equal(bson.M{
+		"$or": []bson.M{
+			{"di": 20141231, "ti": bson.M{"$gte": 120000}},
+			{"di": bson.M{"$gt": 20141231, "$lt": 20150101}},
+			{"di": 20150101, "ti": bson.M{"$lte": 120000}},
+		},
+	}, Query(20141231, 120000, 20150101, 120000))
+}
+
+func TestWindowTestSuite(t *testing.T) {
+	suite.Run(t, new(WindowTestSuite))
+}